@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 )
@@ -12,41 +15,228 @@ import (
 // set while writes are being applied.
 type Benchmark struct {
 	id   string
+	path string
 	c    Collection
 	mu   *sync.RWMutex
 	wg   *sync.WaitGroup
 	done chan bool
+	scan Scan
+
+	writers int // goroutines applying row sets
+	readers int // concurrent scans at each poll
+
+	ctx         context.Context // cancelled when the run fails or is closed
+	cancel      context.CancelFunc
+	scanTimeout time.Duration // time allowed each scan, 0 for no limit
+
+	trace *Trace          // records the operations of the run, if not nil
+	polls []time.Duration // replayed poll times since the start, nil to poll every interval
+	polln int64           // polls started
+
+	maxErrors int       // failed writes tolerated before the run fails
+	errors    int64     // failed writes, under smu
+	err       error     // the write error that failed the run, under smu
+	failed    chan bool // closed when the run fails
+
+	smu     sync.Mutex
+	rows    int64 // rows passed to Set
+	logical int64 // key and value bytes passed to Set
+	live    int64 // key and value bytes visited by the last completed scan
+	written int64 // process write_bytes when Run was called, -1 if unknown
+
+	res     ResourceSample // resource usage at the previous poll
+	resRows int64          // rows passed to Set at the previous poll
+
+	stats map[string]interface{} // collection stats at the previous poll, under smu
+
+	ch          chan []*Row // row sets waiting for a writer
+	arrived     int64       // row sets taken from ch
+	sets        int64       // row sets written
+	scans       int64       // scans completed
+	timeouts    int64       // scans stopped by the scan timeout
+	scanned     int64       // rows visited by scans
+	disk        *DiskSample // disk usage at the previous poll
+	setLatency  *Histogram  // time to write each row set
+	scanLatency *Histogram  // time of each scan
+
+	setPrev HistogramSnapshot // setLatency at the previous poll
+	pollAt  time.Time         // time of the previous poll, or the start of the run
+	counted Interval          // counters at the previous poll
+	prev    *PollRecord       // the previous poll, nil before the first
+
+	results *Results
+}
+
+// LiveSample is a snapshot of the counters of a running
+// Benchmark, for reporting progress between polls.
+type LiveSample struct {
+	Time        time.Time
+	Arrived     int64 // row sets taken from the channel
+	RowSets     int64 // row sets written
+	Rows        int64 // rows written
+	Backlog     int   // row sets waiting for a writer
+	Scans       int64 // scans completed
+	Timeouts    int64 // scans stopped by the scan timeout
+	Scanned     int64 // rows visited by scans
+	SetLatency  HistogramSnapshot
+	ScanLatency HistogramSnapshot
+	Disk        *DiskSample            // at the previous poll, nil if not measured
+	Stats       map[string]interface{} // collection stats at the previous poll
+	Resources   ResourceSample
 }
 
 // NewBenchmark returns a initialized Benchmark
 // with an underlying Collection based on the specified
-// id and database path.
-func NewBenchmark(id string, path string) (b *Benchmark, err error) {
+// id, database path and options.
+func NewBenchmark(id string, path string, opts *CollectionOptions) (b *Benchmark, err error) {
+	c, err := openCollection(id, path, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newBenchmark(id, path, c), nil
+}
+
+// newBenchmark returns an initialized Benchmark wrapping
+// an already opened Collection stored at path.
+func newBenchmark(id string, path string, c Collection) (b *Benchmark) {
+	ctx, cancel := context.WithCancel(context.Background())
 	b = &Benchmark{
-		id:   id,
-		wg:   &sync.WaitGroup{},
-		done: make(chan bool),
-	}
-
-	switch id {
-	case "bolt":
-		b.c, err = NewBoltCollection(path)
-	case "kv":
-		b.c, err = NewKVCollection(path)
-	case "kv-mu":
-		b.c, err = NewKVCollection(path)
+		id:      id,
+		path:    path,
+		c:       c,
+		wg:      &sync.WaitGroup{},
+		done:    make(chan bool),
+		failed:  make(chan bool),
+		written: -1,
+		writers: 1,
+		readers: 1,
+		results: &Results{Id: id, Path: path},
+		ctx:     ctx,
+		cancel:  cancel,
+
+		setLatency:  NewHistogram(),
+		scanLatency: NewHistogram(),
+	}
+
+	if id == "kv-mu" {
 		b.mu = &sync.RWMutex{}
-	case "leveldb":
-		b.c, err = NewLevelDBCollection(path)
-	case "noop":
-		b.c, err = NewNoopCollection()
-	default:
-		err = fmt.Errorf("unknown benchmark id: %s", id)
 	}
 
 	return
 }
 
+// SetScan sets how the collection is iterated over
+// when it is polled.  It must be called before Run.
+func (b *Benchmark) SetScan(s Scan) {
+	b.scan = s
+}
+
+// SetConcurrency sets the number of goroutines that apply
+// row sets to the collection, and the number of scans run
+// concurrently at each poll.  It must be called before Run.
+func (b *Benchmark) SetConcurrency(writers, readers int) {
+	if writers > 0 {
+		b.writers = writers
+	}
+	if readers > 0 {
+		b.readers = readers
+	}
+}
+
+// SetScanTimeout sets the time allowed each scan, after
+// which the scan is stopped and counted as timed out.  It
+// must be called before Run.
+func (b *Benchmark) SetScanTimeout(d time.Duration) {
+	b.scanTimeout = d
+}
+
+// SetTrace records the writes, polls and scans of the run
+// to t.  It must be called before Run.
+func (b *Benchmark) SetTrace(t *Trace) {
+	b.trace = t
+}
+
+// SetPolls replaces the poll interval with a schedule of
+// polls, each at a time since the start of the run, as read
+// from a trace to replay.  It must be called before Run.
+func (b *Benchmark) SetPolls(polls []time.Duration) {
+	b.polls = polls
+}
+
+// SetMaxErrors sets the number of failed writes tolerated
+// before the run fails, by default 0.  Row sets that fail to
+// be written within this budget are skipped.  It must be
+// called before Run.
+func (b *Benchmark) SetMaxErrors(n int) {
+	b.maxErrors = n
+}
+
+// Failed returns a channel that is closed when the run fails
+// because more writes failed than SetMaxErrors tolerates.
+// The writers and polls stop, and the sender should stop
+// sending row sets, which are no longer read.
+func (b *Benchmark) Failed() <-chan bool {
+	return b.failed
+}
+
+// Err returns the write error that failed the run, or nil.
+func (b *Benchmark) Err() error {
+	b.smu.Lock()
+	defer b.smu.Unlock()
+	return b.err
+}
+
+// writeFailed records a failed write of a row set, and fails
+// the run if the error budget is exhausted, returning true.
+func (b *Benchmark) writeFailed(err error) bool {
+	b.smu.Lock()
+	defer b.smu.Unlock()
+	b.errors++
+	if b.errors <= int64(b.maxErrors) {
+		log.Printf("%s: write failed, skipping the row set (%d of %d errors tolerated): %v\n",
+			b.id, b.errors, b.maxErrors, err)
+		return false
+	}
+	if b.err == nil {
+		log.Printf("%s: write failed, stopping: %v\n", b.id, err)
+		b.err = err
+		close(b.failed)
+		b.cancel()
+	}
+	return true
+}
+
+// Results returns the measurements recorded by the
+// benchmark.  It is complete once Wait returns.
+func (b *Benchmark) Results() *Results {
+	return b.results
+}
+
+// Live returns a snapshot of the benchmark's counters.
+// It may be called while the benchmark is running.
+func (b *Benchmark) Live() (s LiveSample) {
+	s.Time = time.Now()
+	s.Backlog = len(b.ch)
+	s.SetLatency = b.setLatency.Snapshot()
+	s.ScanLatency = b.scanLatency.Snapshot()
+	s.Resources = SampleResources()
+
+	b.smu.Lock()
+	defer b.smu.Unlock()
+	s.Arrived, s.RowSets, s.Rows = b.arrived, b.sets, b.rows
+	s.Scans, s.Scanned, s.Timeouts = b.scans, b.scanned, b.timeouts
+	s.Disk, s.Stats = b.disk, b.stats
+	return
+}
+
+// Close closes the underlying Collection, without waiting
+// for scans in progress if force is true.  Scans and writes
+// in progress are cancelled.
+func (b *Benchmark) Close(force bool) error {
+	b.cancel()
+	return b.c.Close(force)
+}
+
 // Wait blocks until the Run method has completed.
 func (b *Benchmark) Wait() {
 	b.wg.Wait()
@@ -58,37 +248,99 @@ func (b *Benchmark) Wait() {
 // number of records and the time it took to iterate over
 // those records.
 func (b *Benchmark) Run(ch chan []*Row, dur time.Duration) {
+	if n, err := procWriteBytes(); err == nil {
+		b.written = n
+	}
+	b.res = SampleResources()
+	if sc, ok := b.c.(StatsCollection); ok {
+		b.stats = sc.Stats()
+	}
+	b.results.Scan = b.scan.Mode.String()
+	b.results.Writers = b.writers
+	b.results.Readers = b.readers
+	b.results.Start = time.Now()
+	b.pollAt = b.results.Start
+	b.trace.begin(b.results.Start)
+	b.ch = ch
+
 	b.wg.Add(1)
 	go b.Writer(ch)
 	go b.Poll(dur)
 }
 
 // Writer reads rows from ch and writes them to
-// the underlying Collection
+// the underlying Collection, from b.writers goroutines.
 func (b *Benchmark) Writer(ch chan []*Row) {
+	var amu sync.Mutex
 	n := int64(0)        // row set counter
 	ns := int64(0)       // elapsed time in nanoseconds
 	var t0, t1 time.Time // time between arrivals
-	for rows := range ch {
-		n, t1 = n+1, time.Now()
-		if n > 1 {
-			ns += t1.Sub(t0).Nanoseconds()
-		}
-		t0 = t1
 
-		if b.mu != nil {
-			b.mu.Lock()
-		}
-		err := b.c.Set(rows)
-		if b.mu != nil {
-			b.mu.Unlock()
-		}
+	var wg sync.WaitGroup
+	for i := 0; i < b.writers; i++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for rows := range ch {
+				select {
+				case <-b.failed:
+					return
+				default:
+				}
 
-		if err != nil {
-			log.Println(err)
-			return
-		}
+				amu.Lock()
+				n, t1 = n+1, time.Now()
+				if n > 1 {
+					ns += t1.Sub(t0).Nanoseconds()
+				}
+				t0 = t1
+				amu.Unlock()
+
+				b.smu.Lock()
+				b.arrived++
+				seq := b.arrived
+				b.smu.Unlock()
+
+				if b.mu != nil {
+					b.mu.Lock()
+				}
+				ts := time.Now()
+				err := b.c.Set(b.ctx, rows)
+				d := time.Since(ts)
+				b.setLatency.Observe(d)
+				if b.mu != nil {
+					b.mu.Unlock()
+				}
+				b.traceOp(TraceOp{Op: "set", Seq: seq, Rows: len(rows), Worker: w, Dur: d}, err)
+
+				if err != nil {
+					if b.ctx.Err() != nil {
+						return // the run failed or was closed
+					}
+					if b.writeFailed(err) {
+						return
+					}
+					continue
+				}
+
+				b.account(rows)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	b.smu.Lock()
+	b.results.Lock()
+	b.results.RowSets = b.sets
+	b.results.Errors = b.errors
+	if b.err != nil {
+		b.results.Error = b.err.Error()
+	}
+	if n > 1 {
+		b.results.Arrival = time.Duration(ns / (n - 1))
 	}
+	b.results.Unlock()
+	b.smu.Unlock()
 
 	b.done <- true
 	if n > 0 {
@@ -97,38 +349,309 @@ func (b *Benchmark) Writer(ch chan []*Row) {
 	}
 }
 
+// account records the logical size of rows
+// that have been written to the collection.
+func (b *Benchmark) account(rows []*Row) {
+	b.smu.Lock()
+	defer b.smu.Unlock()
+	b.sets++
+	for _, row := range rows {
+		b.rows++
+		b.logical += row.Size()
+	}
+}
+
+// Disk samples the on-disk size of the database
+// and the bytes written to it so far.
+func (b *Benchmark) Disk() (s DiskSample, err error) {
+	s.Bytes, s.Files, err = DiskUsage(b.path)
+	if err != nil {
+		return
+	}
+
+	s.Written = -1
+	if b.written >= 0 {
+		if n, err := procWriteBytes(); err == nil {
+			s.Written = n - b.written
+		}
+	}
+
+	b.smu.Lock()
+	s.Logical = b.logical
+	s.Live = b.live
+	b.smu.Unlock()
+	return
+}
+
 // Poll wakes up every dur duration and polls the
-// underlying Collection Timer.
+// underlying Collection Timer, along with the size
+// of the database on disk.
 func (b *Benchmark) Poll(dur time.Duration) {
 	defer b.wg.Done()
 	for {
 		select {
 		case _ = <-b.done:
-			if b.mu != nil {
-				b.mu.RLock()
+			if b.Err() == nil {
+				b.polln++
+				b.trace.Record(TraceOp{Op: "end", Seq: b.polln})
+				b.poll()
 			}
-			n, t := b.c.Timing()
-			if b.mu != nil {
-				b.mu.RUnlock()
-			}
-			ms := t.Nanoseconds() / 1e6
-			opsms := int64(n) / ms
-			log.Printf("%s: %d ops in %d ms: %d ops/ms\n",
-				b.id, n, ms, opsms)
+			b.results.Lock()
+			b.results.End = time.Now()
+			b.results.Unlock()
 			return
-		default:
-			time.Sleep(dur)
-			if b.mu != nil {
-				b.mu.RLock()
-			}
-			n, t := b.c.Timing()
-			if b.mu != nil {
-				b.mu.RUnlock()
-			}
-			ms := t.Nanoseconds() / 1e6
-			opsms := int64(n) / ms
-			log.Printf("%s: %d ops in %d ms: %d ops/ms\n",
-				b.id, n, ms, opsms)
+		case <-b.failed:
+			// the collection may be unusable, so stop
+			// polling and wait for the writers to return
+			<-b.done
+			b.results.Lock()
+			b.results.End = time.Now()
+			b.results.Unlock()
+			return
+		case <-b.nextPoll(dur):
+			b.polln++
+			b.trace.Record(TraceOp{Op: "poll", Seq: b.polln})
+			b.poll()
+		}
+	}
+}
+
+// nextPoll returns a channel that receives when the next
+// poll is due: after dur, or at the next time of the poll
+// schedule, never once the schedule is exhausted.
+func (b *Benchmark) nextPoll(dur time.Duration) <-chan time.Time {
+	if b.polls == nil {
+		return time.After(dur)
+	}
+	if int(b.polln) >= len(b.polls) {
+		return nil
+	}
+	return time.After(b.polls[b.polln] - time.Since(b.results.Start))
+}
+
+// traceOp records op to the trace, with err if not nil.
+func (b *Benchmark) traceOp(op TraceOp, err error) {
+	if b.trace == nil {
+		return
+	}
+	if err != nil {
+		op.Err = err.Error()
+	}
+	b.trace.Record(op)
+}
+
+func (b *Benchmark) poll() {
+	var m0, m1 runtime.MemStats
+	runtime.ReadMemStats(&m0)
+	n, t, timeouts := b.scanAll()
+	runtime.ReadMemStats(&m1)
+
+	rec := PollRecord{Time: time.Now(), Rows: n, Scan: t, Timeouts: timeouts}
+	rec.Interval = b.interval(rec.Time)
+	b.logInterval(&rec)
+	if timeouts > 0 {
+		log.Printf("%s: %d of %d scans timed out after %s\n", b.id, timeouts, b.readers, b.scanTimeout)
+	}
+	b.prev = &rec
+	set := b.setLatency.Snapshot()
+	rec.SetLatency = set.Sub(b.setPrev).Latency()
+	b.setPrev = set
+	b.pollResources(&rec, &m0, &m1)
+	b.pollStats(&rec)
+	defer func() { b.results.add(rec) }()
+
+	if b.path == "" {
+		return
+	}
+	disk, err := b.Disk()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("%s: %v\n", b.id, err)
+		}
+		return
+	}
+	log.Printf("%s: %s\n", b.id, disk)
+	rec.Disk = &disk
+
+	b.smu.Lock()
+	b.disk = &disk
+	b.smu.Unlock()
+}
+
+// interval returns the work done since the previous poll.
+func (b *Benchmark) interval(now time.Time) *Interval {
+	b.smu.Lock()
+	cur := Interval{
+		RowSets:     b.sets,
+		Rows:        b.rows,
+		Bytes:       b.logical,
+		Scans:       b.scans,
+		RowsScanned: b.scanned,
+	}
+	b.smu.Unlock()
+
+	prev := b.counted
+	b.counted = cur
+	iv := &Interval{
+		Duration:    now.Sub(b.pollAt),
+		RowSets:     cur.RowSets - prev.RowSets,
+		Rows:        cur.Rows - prev.Rows,
+		Bytes:       cur.Bytes - prev.Bytes,
+		Scans:       cur.Scans - prev.Scans,
+		RowsScanned: cur.RowsScanned - prev.RowsScanned,
+	}
+	b.pollAt = now
+	return iv
+}
+
+// logInterval logs the work done since the previous poll
+// and the cost per row of the scan, each with its change
+// from the previous poll.
+func (b *Benchmark) logInterval(rec *PollRecord) {
+	iv, prev := rec.Interval, &Interval{}
+	var prevNs float64
+	if b.prev != nil {
+		prev, prevNs = b.prev.Interval, b.prev.NsPerRow()
+	}
+
+	log.Printf("%s: in %s: wrote %d row sets, %d rows, %s: %.1f rows/s%s\n",
+		b.id, iv.Duration.Round(time.Microsecond), iv.RowSets, iv.Rows, formatBytes(iv.Bytes),
+		iv.Rate(iv.Rows), formatChange(iv.Rate(iv.Rows), prev.Rate(prev.Rows)))
+	log.Printf("%s: in %s: completed %d scans of %d rows: %.1f rows/s%s\n",
+		b.id, iv.Duration.Round(time.Microsecond), iv.Scans, iv.RowsScanned,
+		iv.Rate(iv.RowsScanned), formatChange(iv.Rate(iv.RowsScanned), prev.Rate(prev.RowsScanned)))
+	log.Printf("%s: scanned %d rows in %s: %.1f ns/row%s, %.1f rows/s\n",
+		b.id, rec.Rows, rec.Scan, rec.NsPerRow(), formatChange(rec.NsPerRow(), prevNs), rec.RowsPerSec())
+}
+
+// formatChange formats the change from prev to cur as a
+// percentage, or returns "" if there is no previous value.
+func formatChange(cur, prev float64) string {
+	if prev == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%+.1f%%)", (cur-prev)/prev*100)
+}
+
+// scanAll runs b.readers concurrent scans of the collection,
+// returning the mean rows visited and time taken per scan,
+// and the number of scans that timed out.
+func (b *Benchmark) scanAll() (n int, t time.Duration, timeouts int) {
+	if b.readers == 1 {
+		n, t, timedOut := b.scanOnce(0)
+		if timedOut {
+			timeouts = 1
 		}
+		return n, t, timeouts
+	}
+
+	var wg sync.WaitGroup
+	var smu sync.Mutex
+	for i := 0; i < b.readers; i++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			rows, d, timedOut := b.scanOnce(r)
+			smu.Lock()
+			n += rows
+			t += d
+			if timedOut {
+				timeouts++
+			}
+			smu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return (n + b.readers/2) / b.readers, t / time.Duration(b.readers), timeouts
+}
+
+// scanOnce scans the collection as reader r, logging any
+// error.  A scan stopped by the scan timeout returns the rows
+// visited until then, and is not counted as a completed scan.
+func (b *Benchmark) scanOnce(r int) (n int, t time.Duration, timedOut bool) {
+	ctx := b.ctx
+	if b.scanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.scanTimeout)
+		defer cancel()
+	}
+
+	if b.mu != nil {
+		b.mu.RLock()
+	}
+	n, size, t, err := b.scan.Timing(ctx, b.c)
+	if b.mu != nil {
+		b.mu.RUnlock()
+	}
+	b.traceOp(TraceOp{Op: "scan", Seq: b.polln, Rows: n, Worker: r, Dur: t}, err)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		b.smu.Lock()
+		b.timeouts++
+		b.smu.Unlock()
+		return n, t, true
+	}
+	if err != nil {
+		log.Printf("%s: scan: %v\n", b.id, err)
+		return
+	}
+
+	b.scanLatency.Observe(t)
+	b.smu.Lock()
+	b.scans++
+	b.scanned += int64(n)
+	b.live = size
+	b.smu.Unlock()
+	return
+}
+
+// pollStats logs the collection's internal statistics,
+// if it reports any, with the change since the previous
+// poll.
+func (b *Benchmark) pollStats(rec *PollRecord) {
+	sc, ok := b.c.(StatsCollection)
+	if !ok {
+		return
 	}
+	stats := sc.Stats()
+	if len(stats) == 0 {
+		return
+	}
+	rec.Stats, rec.StatsDelta = stats, StatsDelta(stats, b.stats)
+	log.Printf("%s: stats: %s\n", b.id, formatStats(stats, rec.StatsDelta))
+	b.smu.Lock()
+	b.stats = stats
+	b.smu.Unlock()
+}
+
+// pollResources logs the resource usage of the process
+// since the previous poll.  The runtime counts allocations
+// for the whole process, so those made while the readers
+// were each scanning rec.Rows rows, between m0 and m1, are
+// attributed to the scan window, writers' included, and the
+// remainder to the rows written since the previous poll.
+func (b *Benchmark) pollResources(rec *PollRecord, m0, m1 *runtime.MemStats) {
+	res := sampleResources(m1)
+	d := res.Sub(b.res)
+	b.res = res
+
+	b.smu.Lock()
+	written := b.rows - b.resRows
+	b.resRows = b.rows
+	b.results.Lock()
+	b.results.Rows = b.rows
+	b.results.Unlock()
+	b.smu.Unlock()
+
+	scan := m1.Mallocs - m0.Mallocs
+	var scanPerRow, writePerRow float64
+	if n := rec.Rows * b.readers; n > 0 {
+		scanPerRow = float64(scan) / float64(n)
+	}
+	if written > 0 && d.Mallocs > scan {
+		writePerRow = float64(d.Mallocs-scan) / float64(written)
+	}
+
+	rec.Resources, rec.ScanWindowAllocs, rec.WriteAllocs = d, scanPerRow, writePerRow
+	log.Printf("%s: %s: %.1f allocs/row scanned in the scan window, %.1f allocs/row written outside it\n",
+		b.id, d, scanPerRow, writePerRow)
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingCollection fails every write after the first ok.
+type failingCollection struct {
+	Collection
+	mu sync.Mutex
+	ok int
+}
+
+func (c *failingCollection) Set(ctx context.Context, rows []*Row) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ok == 0 {
+		return errors.New("disk full")
+	}
+	c.ok--
+	return c.Collection.Set(ctx, rows)
+}
+
+func TestBenchmarkWriteFailed(t *testing.T) {
+	for _, tc := range []struct {
+		maxErrors int
+		sets      int64
+		errors    int64
+	}{
+		{0, 3, 1},
+		{2, 3, 3},
+	} {
+		name := fmt.Sprintf("max errors %d", tc.maxErrors)
+		c, err := NewMapCollection()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := newBenchmark("map", "", &failingCollection{Collection: c, ok: 3})
+		b.SetMaxErrors(tc.maxErrors)
+
+		ch := make(chan []*Row)
+		b.Run(ch, time.Hour)
+
+		// send until the run fails, as the sender would block
+		// forever once the writers have returned
+		sent := 0
+	send:
+		for {
+			select {
+			case ch <- testRows[:1]:
+				sent++
+			case <-b.Failed():
+				break send
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: run did not fail after %d row sets", name, sent)
+			}
+		}
+		close(ch)
+
+		done := make(chan bool)
+		go func() {
+			b.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: run did not finish after the failed write", name)
+		}
+
+		r := b.Results()
+		if b.Err() == nil || r.Error != "disk full" {
+			t.Errorf("%s: expected the write error in the results, got %v, %q", name, b.Err(), r.Error)
+		}
+		if r.RowSets != tc.sets || r.Errors != tc.errors {
+			t.Errorf("%s: expected %d row sets and %d errors, got %d and %d",
+				name, tc.sets, tc.errors, r.RowSets, r.Errors)
+		}
+		if r.End.IsZero() {
+			t.Errorf("%s: expected the run to end", name)
+		}
+	}
+}
+
+// blockedCollection scans until its context is done.
+type blockedCollection struct {
+	Collection
+}
+
+func (c *blockedCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	<-ctx.Done()
+	return 1, 2, time.Since(t0)
+}
+
+func TestBenchmarkScanTimeout(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBenchmark("map", "", &blockedCollection{c})
+	b.SetScanTimeout(20 * time.Millisecond)
+
+	ch := make(chan []*Row)
+	b.Run(ch, 10*time.Millisecond)
+	ch <- testRows[:1]
+	time.Sleep(50 * time.Millisecond)
+	close(ch)
+	b.Wait()
+
+	r := b.Results()
+	if len(r.Polls) == 0 {
+		t.Fatal("expected the run to be polled")
+	}
+	for i, p := range r.Polls {
+		if p.Timeouts != 1 || p.Rows != 1 || p.Scan < 20*time.Millisecond {
+			t.Errorf("poll %d: expected 1 timed out scan of 1 row taking at least 20ms, got %d of %d rows in %s",
+				i, p.Timeouts, p.Rows, p.Scan)
+		}
+	}
+	if s := b.Live(); s.Timeouts != int64(len(r.Polls)) || s.Scans != 0 {
+		t.Errorf("expected %d timeouts and no completed scans, got %d and %d", len(r.Polls), s.Timeouts, s.Scans)
+	}
+}
+
+func TestBenchmarkReaders(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBenchmark("map", "", c)
+	b.SetConcurrency(1, 4)
+
+	ch := make(chan []*Row)
+	b.Run(ch, time.Hour)
+	ch <- testRows
+	close(ch)
+	b.Wait()
+
+	// each of the 4 readers scans every row
+	p, ok := b.Results().Final()
+	if !ok {
+		t.Fatal("expected a final poll")
+	}
+	if p.Rows != len(testRows) {
+		t.Errorf("expected the mean scan of %d rows, got %d", len(testRows), p.Rows)
+	}
+	if s := b.Live(); s.Scans != 4 || s.Scanned != 4*int64(len(testRows)) {
+		t.Errorf("expected 4 scans of %d rows, got %d of %d", len(testRows), s.Scans, s.Scanned)
+	}
+}
+
+func TestBenchmarkIntervals(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBenchmark("map", "", c)
+
+	ch := make(chan []*Row)
+	b.Run(ch, 5*time.Millisecond)
+	for i := 0; i < 20; i++ {
+		ch <- testRows[i*10 : i*10+10]
+		time.Sleep(time.Millisecond)
+	}
+	close(ch)
+	b.Wait()
+
+	r := b.Results()
+	if len(r.Polls) < 2 {
+		t.Fatalf("expected several polls, got %d", len(r.Polls))
+	}
+	var sum Interval
+	for i, p := range r.Polls {
+		if p.Interval == nil || p.Interval.Duration <= 0 {
+			t.Fatalf("poll %d: expected an interval, got %+v", i, p.Interval)
+		}
+		sum.RowSets += p.Interval.RowSets
+		sum.Rows += p.Interval.Rows
+		sum.Bytes += p.Interval.Bytes
+		sum.Scans += p.Interval.Scans
+		sum.RowsScanned += p.Interval.RowsScanned
+	}
+	if sum.RowSets != 20 || sum.Rows != 200 || sum.Bytes != 400 {
+		t.Errorf("expected intervals to add up to 20 row sets, 200 rows and 400 bytes, got %+v", sum)
+	}
+	if sum.Scans != int64(len(r.Polls)) || sum.RowsScanned != b.Live().Scanned {
+		t.Errorf("expected %d scans of %d rows, got %d of %d", len(r.Polls), b.Live().Scanned, sum.Scans, sum.RowsScanned)
+	}
+}
+
+func TestFormatChange(t *testing.T) {
+	for _, tc := range []struct {
+		cur, prev float64
+		s         string
+	}{
+		{10, 0, ""},
+		{11, 10, " (+10.0%)"},
+		{5, 10, " (-50.0%)"},
+		{10, 10, " (+0.0%)"},
+	} {
+		if s := formatChange(tc.cur, tc.prev); s != tc.s {
+			t.Errorf("formatChange(%v, %v): expected %q, got %q", tc.cur, tc.prev, tc.s, s)
+		}
+	}
+}
+
+func TestBenchmarkPollEmpty(t *testing.T) {
+	for _, id := range memoryIds {
+		c, err := openCollection(id, "", true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := newBenchmark(id, "", c)
+
+		ch := make(chan []*Row)
+		b.Run(ch, time.Hour)
+		close(ch)
+		b.Wait()
+
+		r := b.Results()
+		p, ok := r.Final()
+		if !ok {
+			t.Fatalf("%s: expected a final poll", id)
+		}
+		if p.Rows != 0 || p.RowsPerSec() != 0 || p.NsPerRow() != 0 || p.Interval == nil || p.Interval.Rows != 0 {
+			t.Errorf("%s: expected an empty scan, got %d rows in %s: %+v", id, p.Rows, p.Scan, p.Interval)
+		}
+		if s := r.Summary(); !strings.Contains(s, "0 row sets") {
+			t.Errorf("%s: unexpected summary %q", id, s)
+		}
+		b.Close(false)
+	}
+}
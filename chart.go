@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// chartColors are the colors of successive series.
+var chartColors = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728",
+	"#9467bd", "#8c564b", "#e377c2", "#7f7f7f",
+}
+
+const (
+	chartWidth  = 720
+	chartHeight = 280
+	chartLeft   = 80 // margins around the plot area
+	chartRight  = 20
+	chartTop    = 30
+	chartBottom = 40
+	chartLegend = 18 // height of each legend row
+)
+
+// chartSeries is one line of a lineChart.
+type chartSeries struct {
+	Name  string
+	Color int  // index into chartColors
+	Dash  bool // draw a dashed line
+	X, Y  []float64
+}
+
+// lineChart plots series of points from zero on both axes.
+type lineChart struct {
+	Title   string
+	FormatX func(float64) string
+	FormatY func(float64) string
+	Series  []chartSeries
+}
+
+// barChart compares one value per name.
+type barChart struct {
+	Title  string
+	Format func(float64) string
+	Names  []string
+	Values []float64
+}
+
+// niceTicks returns about n evenly spaced round values from
+// zero to at least max.
+func niceTicks(max float64, n int) (ticks []float64) {
+	if max <= 0 || math.IsNaN(max) || math.IsInf(max, 0) {
+		max = 1
+	}
+	raw := max / float64(n)
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+	f := 10.0
+	for _, g := range []float64{1, 2, 5} {
+		if raw <= g*exp {
+			f = g
+			break
+		}
+	}
+	for i := 0; ; i++ {
+		// divide by the inverse of small powers of ten,
+		// which are exact, to give round ticks
+		v := float64(i) * f * exp
+		if exp < 1 {
+			v = float64(i) * f / math.Round(1/exp)
+		}
+		ticks = append(ticks, v)
+		if v >= max {
+			return
+		}
+	}
+}
+
+// svg returns the chart as an SVG element.
+func (c *lineChart) svg() string {
+	var maxX, maxY float64
+	for _, s := range c.Series {
+		for i := range s.X {
+			maxX = math.Max(maxX, s.X[i])
+			maxY = math.Max(maxY, s.Y[i])
+		}
+	}
+	xt, yt := niceTicks(maxX, 6), niceTicks(maxY, 5)
+	maxX, maxY = xt[len(xt)-1], yt[len(yt)-1]
+
+	pw := float64(chartWidth - chartLeft - chartRight)
+	ph := float64(chartHeight - chartTop - chartBottom)
+	px := func(x float64) float64 { return chartLeft + x/maxX*pw }
+	py := func(y float64) float64 { return chartTop + ph - y/maxY*ph }
+
+	buf := &strings.Builder{}
+	height := chartHeight + chartLegend*len(c.Series)
+	svgOpen(buf, c.Title, height)
+
+	for _, v := range yt {
+		fmt.Fprintf(buf, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n",
+			chartLeft, py(v), chartWidth-chartRight, py(v))
+		fmt.Fprintf(buf, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n",
+			chartLeft-6, py(v), html.EscapeString(c.FormatY(v)))
+	}
+	for _, v := range xt {
+		fmt.Fprintf(buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+			px(v), chartHeight-chartBottom+16, html.EscapeString(c.FormatX(v)))
+	}
+	fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%.0f" height="%.0f" fill="none" stroke="#999"/>`+"\n",
+		chartLeft, chartTop, pw, ph)
+
+	for i, s := range c.Series {
+		color := chartColors[s.Color%len(chartColors)]
+		dash := ""
+		if s.Dash {
+			dash = ` stroke-dasharray="6 3"`
+		}
+		pts := make([]string, len(s.X))
+		for j := range s.X {
+			pts[j] = fmt.Sprintf("%.1f,%.1f", px(s.X[j]), py(s.Y[j]))
+		}
+		fmt.Fprintf(buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"%s/>`+"\n",
+			strings.Join(pts, " "), color, dash)
+
+		y := chartHeight + chartLegend*i
+		fmt.Fprintf(buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"%s/>`+"\n",
+			chartLeft, y-4, chartLeft+24, y-4, color, dash)
+		fmt.Fprintf(buf, `<text x="%d" y="%d">%s</text>`+"\n", chartLeft+30, y, html.EscapeString(s.Name))
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.String()
+}
+
+// svg returns the chart as an SVG element, with one
+// horizontal bar per name.
+func (c *barChart) svg() string {
+	const bar, gap, label = 22, 6, 160
+
+	var max float64
+	for _, v := range c.Values {
+		max = math.Max(max, v)
+	}
+	ticks := niceTicks(max, 5)
+	max = ticks[len(ticks)-1]
+	pw := float64(chartWidth - label - chartRight)
+	px := func(v float64) float64 { return label + v/max*pw }
+
+	buf := &strings.Builder{}
+	height := chartTop + len(c.Names)*(bar+gap) + 10
+	svgOpen(buf, c.Title, height)
+
+	for i, name := range c.Names {
+		y := chartTop + i*(bar+gap)
+		fmt.Fprintf(buf, `<text x="%d" y="%d" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n",
+			label-6, y+bar/2, html.EscapeString(name))
+		fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`+"\n",
+			label, y, px(c.Values[i])-label, bar, chartColors[i%len(chartColors)])
+		fmt.Fprintf(buf, `<text x="%.1f" y="%d" dominant-baseline="middle">%s</text>`+"\n",
+			px(c.Values[i])+4, y+bar/2, html.EscapeString(c.Format(c.Values[i])))
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.String()
+}
+
+func svgOpen(buf *strings.Builder, title string, height int) {
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		chartWidth, height, chartWidth, height)
+	fmt.Fprintf(buf, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`+"\n",
+		chartLeft, html.EscapeString(title))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNiceTicks(t *testing.T) {
+	for _, c := range []struct {
+		max   float64
+		ticks []float64
+	}{
+		{0, []float64{0, 0.2, 0.4, 0.6, 0.8, 1}},
+		{9, []float64{0, 2, 4, 6, 8, 10}},
+		{10, []float64{0, 2, 4, 6, 8, 10}},
+		{230, []float64{0, 50, 100, 150, 200, 250}},
+	} {
+		if ticks := niceTicks(c.max, 5); !reflect.DeepEqual(ticks, c.ticks) {
+			t.Errorf("niceTicks(%g): expected %v, got %v", c.max, c.ticks, ticks)
+		}
+	}
+}
+
+func TestLineChart(t *testing.T) {
+	c := &lineChart{
+		Title:   "a < b",
+		FormatX: formatCount,
+		FormatY: formatCount,
+		Series:  []chartSeries{{Name: "one", X: []float64{0, 10}, Y: []float64{0, 9}}},
+	}
+	svg := c.svg()
+	for _, want := range []string{"<svg", "a &lt; b", `points="80.0,240.0 700.0,`, ">one</text>", "</svg>"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected %q in:\n%s", want, svg)
+		}
+	}
+}
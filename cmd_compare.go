@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var compareUsage = `USAGE:
+
+kvbench compare [-alpha a] results...
+
+Compare the results files written by two or more kvbench run
+-results invocations.  Each argument is a results file, or a quoted
+glob pattern matching the results of repeated runs of the same
+configuration, and is a column of the table.  The host, filesystem
+and data file digest of each column are shown first, from the
+metadata the results were written with.
+
+Each measurement is shown as its median and the 95% confidence
+interval of the median, as a percentage, across the runs of the
+column.  Each run contributes one value: run measurements, such as
+bytes on disk, are taken once per run, and poll measurements, such
+as rows scanned per millisecond, contribute the median of the run's
+polls, as successive polls of one run are not independent.
+Confidence intervals need six or more runs, and are shown as ± ?
+with fewer.
+
+Each column after the first is followed by the change in the
+median from the first column and the p-value of a Mann-Whitney U
+test of whether the runs differ.  Changes with a p-value of at
+least -alpha are shown as ~, as noise.  When there are too few runs
+for any change to be significant at -alpha, four or more of each
+at the default -alpha, the change is shown as too few runs without
+a p-value.
+
+OPTIONS
+
+-alpha a - significance level, by default 0.05
+`
+
+// compareMetric is one row of the comparison table.
+type compareMetric struct {
+	name    string
+	samples func(r *Results) []float64
+	format  func(v float64) string
+}
+
+func formatCount(v float64) string { return fmt.Sprintf("%.0f", v) }
+func formatRatio(v float64) string { return fmt.Sprintf("%.2f", v) }
+
+func formatDuration(v float64) string {
+	d := time.Duration(v)
+	if d < time.Second {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// runMetric returns a metric with one sample per run.
+func runMetric(name string, fn func(r *Results) (float64, bool), format func(float64) string) compareMetric {
+	return compareMetric{name, func(r *Results) []float64 {
+		if v, ok := fn(r); ok {
+			return []float64{v}
+		}
+		return nil
+	}, format}
+}
+
+// finalMetric returns a metric computed from the final
+// poll of each run.
+func finalMetric(name string, fn func(p PollRecord) (float64, bool), format func(float64) string) compareMetric {
+	return runMetric(name, func(r *Results) (float64, bool) {
+		p, ok := r.Final()
+		if !ok {
+			return 0, false
+		}
+		return fn(p)
+	}, format)
+}
+
+// sumMetric returns a metric summed over the polls of
+// each run.
+func sumMetric(name string, fn func(p PollRecord) float64, format func(float64) string) compareMetric {
+	return runMetric(name, func(r *Results) (v float64, ok bool) {
+		for _, p := range r.Polls {
+			v += fn(p)
+		}
+		return v, len(r.Polls) > 0
+	}, format)
+}
+
+// pollMetric returns a metric with one sample per poll.
+func pollMetric(name string, fn func(p PollRecord) (float64, bool), format func(float64) string) compareMetric {
+	return compareMetric{name, func(r *Results) (xs []float64) {
+		for _, p := range r.Polls {
+			if v, ok := fn(p); ok {
+				xs = append(xs, v)
+			}
+		}
+		return
+	}, format}
+}
+
+func pollCPU(p PollRecord) float64 {
+	var d time.Duration
+	if p.Resources.User > 0 {
+		d += p.Resources.User
+	}
+	if p.Resources.Sys > 0 {
+		d += p.Resources.Sys
+	}
+	return float64(d)
+}
+
+var compareMetrics = []compareMetric{
+	pollMetric("rows/s scanned", func(p PollRecord) (float64, bool) { return p.RowsPerSec(), p.Scan > 0 }, formatRatio),
+	pollMetric("ns/row scanned", func(p PollRecord) (float64, bool) { return p.NsPerRow(), p.Rows > 0 }, formatRatio),
+	pollMetric("rows written/s", func(p PollRecord) (float64, bool) {
+		if p.Interval == nil {
+			return 0, false
+		}
+		return p.Interval.Rate(p.Interval.Rows), true
+	}, formatRatio),
+	pollMetric("rows scanned/s", func(p PollRecord) (float64, bool) {
+		if p.Interval == nil {
+			return 0, false
+		}
+		return p.Interval.Rate(p.Interval.RowsScanned), true
+	}, formatRatio),
+	pollMetric("allocs/row scan window", func(p PollRecord) (float64, bool) { return p.ScanWindowAllocs, p.Rows > 0 }, formatRatio),
+	pollMetric("allocs/row written outside scans", func(p PollRecord) (float64, bool) { return p.WriteAllocs, p.WriteAllocs > 0 }, formatRatio),
+	pollMetric("set latency p50", func(p PollRecord) (float64, bool) {
+		if p.SetLatency == nil {
+			return 0, false
+		}
+		return float64(p.SetLatency.P50), true
+	}, formatDuration),
+	pollMetric("set latency p99", func(p PollRecord) (float64, bool) {
+		if p.SetLatency == nil {
+			return 0, false
+		}
+		return float64(p.SetLatency.P99), true
+	}, formatDuration),
+	pollMetric("cpu/poll", func(p PollRecord) (float64, bool) { return pollCPU(p), true }, formatDuration),
+	runMetric("duration", func(r *Results) (float64, bool) {
+		return float64(r.End.Sub(r.Start)), !r.End.IsZero()
+	}, formatDuration),
+	runMetric("row sets", func(r *Results) (float64, bool) { return float64(r.RowSets), true }, formatCount),
+	runMetric("rows written", func(r *Results) (float64, bool) { return float64(r.Rows), true }, formatCount),
+	runMetric("inter-arrival", func(r *Results) (float64, bool) { return float64(r.Arrival), r.RowSets > 1 }, formatDuration),
+	finalMetric("final rows scanned", func(p PollRecord) (float64, bool) { return float64(p.Rows), true }, formatCount),
+	finalMetric("final scan", func(p PollRecord) (float64, bool) { return float64(p.Scan), true }, formatDuration),
+	finalMetric("bytes on disk", func(p PollRecord) (float64, bool) {
+		if p.Disk == nil {
+			return 0, false
+		}
+		return float64(p.Disk.Bytes), true
+	}, formatCount),
+	finalMetric("write amplification", func(p PollRecord) (float64, bool) {
+		if p.Disk == nil || p.Disk.Written < 0 {
+			return 0, false
+		}
+		return p.Disk.WriteAmp(), true
+	}, formatRatio),
+	finalMetric("space amplification", func(p PollRecord) (float64, bool) {
+		if p.Disk == nil {
+			return 0, false
+		}
+		return p.Disk.SpaceAmp(), true
+	}, formatRatio),
+	sumMetric("cpu time", pollCPU, formatDuration),
+	sumMetric("gc cycles", func(p PollRecord) float64 { return float64(p.Resources.NumGC) }, formatCount),
+	sumMetric("gc pause", func(p PollRecord) float64 { return float64(p.Resources.PauseTotal) }, formatDuration),
+}
+
+// ResultsGroup is a set of results of repeated runs of one
+// configuration, compared as a single column.
+type ResultsGroup struct {
+	Name    string
+	Results []*Results
+}
+
+// trials returns one value of m per run in the group: the
+// run's sample, or the median of its samples.  The polls of
+// one run are not independent, so groups are compared on
+// these rather than on every poll.
+func (g *ResultsGroup) trials(m compareMetric) (xs []float64) {
+	for _, r := range g.Results {
+		if s := m.samples(r); len(s) > 0 {
+			xs = append(xs, Median(s))
+		}
+	}
+	return
+}
+
+// join returns the distinct values of fn across the group.
+func (g *ResultsGroup) join(fn func(r *Results) string) string {
+	var vs []string
+	for _, r := range g.Results {
+		if v := fn(r); !contains(vs, v) {
+			vs = append(vs, v)
+		}
+	}
+	return strings.Join(vs, ",")
+}
+
+// summarize formats the median of xs and its confidence
+// interval as a percentage of the median.
+func summarize(xs []float64, format func(float64) string) string {
+	if len(xs) == 0 {
+		return "n/a"
+	}
+	med := Median(xs)
+	lo, hi, ok := MedianCI(xs, 0.95)
+	switch {
+	case !ok:
+		return format(med) + " ± ?"
+	case med == 0:
+		return format(med) + " ± 0%"
+	}
+	pct := 100 * math.Max(hi-med, med-lo) / math.Abs(med)
+	return fmt.Sprintf("%s ± %.0f%%", format(med), pct)
+}
+
+// delta formats the change in median from x to y and
+// whether it is significant at alpha.
+func delta(x, y []float64, alpha float64) string {
+	if len(x) == 0 || len(y) == 0 {
+		return ""
+	}
+	n := fmt.Sprintf("n=%d+%d", len(x), len(y))
+
+	mx, my := Median(x), Median(y)
+	change := "0.00%"
+	if mx != 0 {
+		change = fmt.Sprintf("%+.2f%%", 100*(my-mx)/math.Abs(mx))
+	} else if my != 0 {
+		change = "+Inf%"
+	}
+
+	if mannWhitneyMinP(len(x), len(y)) >= alpha {
+		return fmt.Sprintf("%s (too few runs, %s)", change, n)
+	}
+
+	p := MannWhitneyU(x, y)
+	if p >= alpha {
+		return fmt.Sprintf("~ (p=%.3f %s)", p, n)
+	}
+	return fmt.Sprintf("%s (p=%.3f %s)", change, p, n)
+}
+
+// CompareResults writes a table comparing groups of results
+// to w, with changes relative to the first group tested for
+// significance at alpha.  Each run of a group is one sample.
+func CompareResults(w io.Writer, groups []*ResultsGroup, alpha float64) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	row := func(name string, cell func(i int, g *ResultsGroup) (string, string)) {
+		cells := []string{name}
+		for i, g := range groups {
+			v, d := cell(i, g)
+			cells = append(cells, v)
+			if i > 0 {
+				cells = append(cells, d)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	row("", func(i int, g *ResultsGroup) (string, string) { return g.Name, "delta" })
+	row("backend", func(i int, g *ResultsGroup) (string, string) {
+		return g.join(func(r *Results) string { return r.Id }), ""
+	})
+	row("scan", func(i int, g *ResultsGroup) (string, string) {
+		return g.join(func(r *Results) string { return r.Scan }), ""
+	})
+	row("host", func(i int, g *ResultsGroup) (string, string) {
+		return g.join(func(r *Results) string { return r.meta().Hostname }), ""
+	})
+	row("filesystem", func(i int, g *ResultsGroup) (string, string) {
+		return g.join(func(r *Results) string { return r.meta().Filesystem }), ""
+	})
+	row("data", func(i int, g *ResultsGroup) (string, string) {
+		return g.join(func(r *Results) string { return r.meta().dataDigest() }), ""
+	})
+	row("runs", func(i int, g *ResultsGroup) (string, string) {
+		return fmt.Sprint(len(g.Results)), ""
+	})
+
+	for _, m := range compareMetrics {
+		base := groups[0].trials(m)
+		row(m.name, func(i int, g *ResultsGroup) (string, string) {
+			xs := g.trials(m)
+			return summarize(xs, m.format), delta(base, xs, alpha)
+		})
+	}
+
+	return tw.Flush()
+}
+
+// SummarizeTrials writes a table of the mean, standard
+// deviation and percentiles of each measurement across the
+// repeated runs of g to w.  Poll measurements contribute the
+// median of each run.
+func SummarizeTrials(w io.Writer, g *ResultsGroup) error {
+	fmt.Fprintf(w, "%s, %d trials\n", g.Name, len(g.Results))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tn\tmean\tstddev\tmin\tp50\tp90\tmax")
+	for _, m := range compareMetrics {
+		xs := g.trials(m)
+		if len(xs) == 0 {
+			fmt.Fprintf(tw, "%s\t0\tn/a\t\t\t\t\t\n", m.name)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", m.name, len(xs),
+			m.format(Mean(xs)), m.format(StdDev(xs)), m.format(Percentile(xs, 0)),
+			m.format(Percentile(xs, 50)), m.format(Percentile(xs, 90)), m.format(Percentile(xs, 100)))
+	}
+	return tw.Flush()
+}
+
+// readResultsGroup reads the results files matching pattern.
+func readResultsGroup(pattern string) (g *ResultsGroup, err error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no results files match %s", pattern)
+	}
+	sort.Strings(files)
+
+	g = &ResultsGroup{Name: pattern}
+	if len(files) == 1 {
+		g.Name = filepath.Base(files[0])
+	}
+	for _, file := range files {
+		r, err := ReadResults(file)
+		if err != nil {
+			return nil, err
+		}
+		g.Results = append(g.Results, r)
+	}
+	return g, nil
+}
+
+func compareCommand(args []string) (err error) {
+	var alpha float64
+
+	fs := newFlagSet("compare", compareUsage)
+	fs.Float64Var(&alpha, "alpha", 0.05, "significance level")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		return usageError{fmt.Errorf("at least two results files are required")}
+	}
+	if alpha <= 0 || alpha >= 1 {
+		return usageError{fmt.Errorf("invalid -alpha %g", alpha)}
+	}
+
+	groups := make([]*ResultsGroup, fs.NArg())
+	for i, pattern := range fs.Args() {
+		if groups[i], err = readResultsGroup(pattern); err != nil {
+			return
+		}
+	}
+
+	return CompareResults(os.Stdout, groups, alpha)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var generateUsage = `USAGE:
+
+kvbench generate OPTIONS -o dat
+
+Generate a sample data file of -n blocks of records, each of which
+is written to the collection as one row set by kvbench run.  Given
+identical options, and in particular the same -r seed, an identical
+data file is generated.
+
+OPTIONS
+
+-r n - pseudo-random seed
+-n n - total number of blocks to generate
+
+-b0 min - minimum number of records per block
+-b1 max - maximum number of records per block
+
+-k0 min - minimum length of key to generate
+-k1 max - maximum length of key to generate
+
+-v0 min - minimum length of value to generate
+-v1 max - maximum length of value to generate
+
+-o dat - output path for data file
+`
+
+// generateConfig holds the options of kvbench generate.
+type generateConfig struct {
+	seed   int64
+	blocks int
+	b0, b1 int
+	k0, k1 int
+	v0, v1 int
+	output string
+}
+
+var generateFlags = []string{"n", "b0", "b1", "k0", "k1", "v0", "v1", "o"}
+
+// flags registers every option except the seed with fs.
+func (c *generateConfig) flags(fs *flag.FlagSet) {
+	fs.IntVar(&c.blocks, "n", 200, "number of record blocks")
+	fs.IntVar(&c.b0, "b0", 1, "minimum number of records per block")
+	fs.IntVar(&c.b1, "b1", 1000, "maximum number of records per block")
+	fs.IntVar(&c.k0, "k0", 32, "minimum number of bytes in a key")
+	fs.IntVar(&c.k1, "k1", 32, "maximum number of bytes in a key")
+	fs.IntVar(&c.v0, "v0", 512, "minimum number of bytes in a value")
+	fs.IntVar(&c.v1, "v1", 1024, "maximum number of bytes in a value")
+	fs.StringVar(&c.output, "o", "", "output path for data")
+}
+
+// owns reports whether the flag name is a generate option.
+func (c *generateConfig) owns(name string) bool {
+	return contains(generateFlags, name)
+}
+
+func (c *generateConfig) validate() error {
+	switch {
+	case c.output == "":
+		return fmt.Errorf("missing required -o <dat> argument")
+	case c.blocks < 0:
+		return fmt.Errorf("invalid number of blocks -n %d", c.blocks)
+	case c.b0 < 0 || c.b1 < c.b0:
+		return fmt.Errorf("invalid records per block -b0 %d -b1 %d", c.b0, c.b1)
+	case c.k0 < 1 || c.k1 < c.k0:
+		return fmt.Errorf("invalid key length -k0 %d -k1 %d: keys must be at least one byte", c.k0, c.k1)
+	case c.v0 < 0 || c.v1 < c.v0:
+		return fmt.Errorf("invalid value length -v0 %d -v1 %d", c.v0, c.v1)
+	}
+	return nil
+}
+
+// generate writes the data file using rnd.
+func (c *generateConfig) generate(rnd *Random) (err error) {
+	fh, err := os.Create(c.output)
+	if err != nil {
+		return
+	}
+
+	log.Printf("writing data to %s\n", c.output)
+	err = rnd.Write(fh, c.blocks, c.b0, c.b1, c.k0, c.k1, c.v0, c.v1)
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+func generateCommand(args []string) (err error) {
+	c := &generateConfig{}
+
+	fs := newFlagSet("generate", generateUsage)
+	fs.Int64Var(&c.seed, "r", 0, "pseudo random seed")
+	c.flags(fs)
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	if err = c.validate(); err != nil {
+		return usageError{err}
+	}
+
+	return c.generate(NewRandom(c.seed))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var inspectUsage = `USAGE:
+
+kvbench inspect -i dat
+kvbench inspect -b bench -f path
+
+Summarize the data file -i: the number of blocks, rows and distinct
+keys, and the range of block sizes and key and value lengths.  Or
+summarize the -b benchmark's database at -f path: the number of rows,
+their key and value bytes, the files on disk and the backend's
+internal statistics.  Both may be given at once.
+
+OPTIONS
+
+-i dat   - input path for data file
+-b bench - name of the benchmark whose database to summarize
+-f path  - path to the database, or host:port for resp and remote
+
+-sqlite-journal mode - sqlite journal_mode
+-sqlite-sync level   - sqlite synchronous level
+`
+
+// lengthSummary accumulates the range and mean
+// of a series of lengths.
+type lengthSummary struct {
+	n, min, max, sum int64
+}
+
+func (s *lengthSummary) add(x int64) {
+	if s.n == 0 || x < s.min {
+		s.min = x
+	}
+	if x > s.max {
+		s.max = x
+	}
+	s.n++
+	s.sum += x
+}
+
+func (s lengthSummary) String() string {
+	if s.n == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d-%d, mean %.1f", s.min, s.max, float64(s.sum)/float64(s.n))
+}
+
+// DataSummary describes the contents of a data file.
+type DataSummary struct {
+	Blocks   int
+	Rows     int
+	Keys     int // distinct keys
+	Block    lengthSummary
+	KeyLen   lengthSummary
+	ValueLen lengthSummary
+}
+
+func (s *DataSummary) String() string {
+	return fmt.Sprintf("%d blocks, %d rows, %d distinct keys: rows per block %s, key bytes %s, value bytes %s",
+		s.Blocks, s.Rows, s.Keys, s.Block, s.KeyLen, s.ValueLen)
+}
+
+// SummarizeData reads the data file in r to the end.
+func SummarizeData(r io.Reader) (s *DataSummary, err error) {
+	s = &DataSummary{}
+	keys := make(map[string]bool)
+	br := bufio.NewReader(r)
+	for {
+		var rows []*Row
+		rows, err = ReadRows(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", s.Blocks, err)
+		}
+
+		s.Blocks++
+		s.Block.add(int64(len(rows)))
+		for _, row := range rows {
+			s.Rows++
+			s.KeyLen.add(int64(len(row.Key.b)))
+			s.ValueLen.add(int64(len(row.Value.b)))
+			keys[string(row.Key.b)] = true
+		}
+	}
+	s.Keys = len(keys)
+	return s, nil
+}
+
+// CollectionSummary describes the contents of a collection.
+type CollectionSummary struct {
+	Rows     int
+	KeyLen   lengthSummary
+	ValueLen lengthSummary
+}
+
+func (s *CollectionSummary) String() string {
+	return fmt.Sprintf("%d rows, %d key bytes, %d value bytes: key bytes %s, value bytes %s",
+		s.Rows, s.KeyLen.sum, s.ValueLen.sum, s.KeyLen, s.ValueLen)
+}
+
+// SummarizeCollection iterates over every row of c.
+func SummarizeCollection(ctx context.Context, c Collection) (s *CollectionSummary, err error) {
+	s = &CollectionSummary{}
+	err = c.ForEach(ctx, func(k, v []byte) error {
+		s.Rows++
+		s.KeyLen.add(int64(len(k)))
+		s.ValueLen.add(int64(len(v)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func inspectCommand(args []string) (err error) {
+	var input, id, path string
+	var opts CollectionOptions
+
+	fs := newFlagSet("inspect", inspectUsage)
+	fs.StringVar(&input, "i", "", "input path for data")
+	fs.StringVar(&id, "b", "", "benchmark id: "+strings.Join(collectionIds, ", "))
+	fs.StringVar(&path, "f", "", "database path, or host:port for resp and remote")
+	sqliteFlags(fs, &opts.SQLite)
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	switch {
+	case input == "" && id == "":
+		return usageError{fmt.Errorf("missing required -i <dat> or -b <benchmarkId> argument")}
+	case id != "" && !contains(collectionIds, id):
+		return usageError{fmt.Errorf("unknown benchmark id: %s", id)}
+	case id != "" && contains(memoryIds, id):
+		return usageError{fmt.Errorf("%s keeps no data to inspect", id)}
+	case id != "" && path == "":
+		return usageError{fmt.Errorf("missing required -f <database> argument")}
+	case id == "" && path != "":
+		return usageError{fmt.Errorf("missing required -b <benchmarkId> argument")}
+	}
+
+	if input != "" {
+		if err = inspectData(input); err != nil {
+			return
+		}
+	}
+	if id != "" {
+		err = inspectCollection(id, path, &opts)
+	}
+	return
+}
+
+func inspectData(path string) (err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	s, err := SummarizeData(fh)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("%s: %d bytes: %s\n", path, fi.Size(), s)
+	return nil
+}
+
+func inspectCollection(id, path string, opts *CollectionOptions) (err error) {
+	if err = checkDatabase(id, path); err != nil {
+		return
+	}
+
+	c, err := openCollection(id, path, false, opts)
+	if err != nil {
+		return
+	}
+	defer c.Close(true)
+
+	s, err := SummarizeCollection(context.Background(), c)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%s: %s\n", id, s)
+
+	if id != "remote" && id != "resp" {
+		n, files, err := DiskUsage(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d bytes on disk in %d files\n", id, n, files)
+	}
+
+	if sc, ok := c.(StatsCollection); ok {
+		if stats := sc.Stats(); len(stats) > 0 {
+			fmt.Printf("%s: stats: %s\n", id, formatStats(stats, nil))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var reportUsage = `USAGE:
+
+kvbench report [-o file] [-title title] results...
+
+Write a self-contained HTML report of the results files written by
+kvbench run -results, with SVG charts of scan throughput, scan
+time and its cost per row, write throughput, set latency and disk
+size over the course of each run, bars
+comparing each results argument, the kvbench compare table, and the
+options each run was made with.  The report embeds everything it
+shows and opens offline.
+
+Each argument is a results file, or a quoted glob pattern matching
+the results of repeated runs of the same configuration, as for
+kvbench compare.
+
+OPTIONS
+
+-o file      - output path for the report, default report.html
+-title title - title of the report
+`
+
+// reportLine is one line chart of the report, plotting a
+// value of each poll of each run.
+type reportLine struct {
+	title  string
+	format func(float64) string
+	values func(p PollRecord) (float64, bool)
+}
+
+var reportLines = []reportLine{
+	{"Scan throughput (rows/s)", formatRatio, func(p PollRecord) (float64, bool) {
+		return p.RowsPerSec(), p.Scan > 0
+	}},
+	{"Scan time", formatDuration, func(p PollRecord) (float64, bool) {
+		return float64(p.Scan), true
+	}},
+	{"Scan time per row (ns)", formatRatio, func(p PollRecord) (float64, bool) {
+		return p.NsPerRow(), p.Rows > 0
+	}},
+	{"Rows written per second", formatRatio, func(p PollRecord) (float64, bool) {
+		if p.Interval == nil {
+			return 0, false
+		}
+		return p.Interval.Rate(p.Interval.Rows), true
+	}},
+	{"Disk size (bytes)", formatCount, func(p PollRecord) (float64, bool) {
+		if p.Disk == nil {
+			return 0, false
+		}
+		return float64(p.Disk.Bytes), true
+	}},
+}
+
+// reportBars lists the compareMetrics shown as bars, each
+// the median across the runs of each results argument of
+// one value per run.
+var reportBars = []string{
+	"rows/s scanned", "set latency p99", "final scan", "bytes on disk", "write amplification",
+}
+
+// reportRun is one run of the report, named for its chart series.
+type reportRun struct {
+	name  string
+	color int
+	r     *Results
+}
+
+// reportRuns names the runs of the groups, numbering the
+// runs of groups with more than one.
+func reportRuns(groups []*ResultsGroup) (runs []reportRun) {
+	for i, g := range groups {
+		for j, r := range g.Results {
+			name := g.Name
+			if len(g.Results) > 1 {
+				name = fmt.Sprintf("%s #%d", g.Name, j+1)
+			}
+			runs = append(runs, reportRun{name, i, r})
+		}
+	}
+	return
+}
+
+// seriesOf returns the values of each poll of run against
+// the time since the run started.
+func seriesOf(run reportRun, name string, dash bool, fn func(p PollRecord) (float64, bool)) (s chartSeries) {
+	s = chartSeries{Name: name, Color: run.color, Dash: dash}
+	for _, p := range run.r.Polls {
+		if v, ok := fn(p); ok {
+			s.X = append(s.X, float64(p.Time.Sub(run.r.Start)))
+			s.Y = append(s.Y, v)
+		}
+	}
+	return
+}
+
+// WriteReport writes an HTML report of groups to w.
+func WriteReport(w io.Writer, title string, groups []*ResultsGroup) (err error) {
+	runs := reportRuns(groups)
+	buf := &bytes.Buffer{}
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(buf, format+"\n", args...)
+	}
+	esc := html.EscapeString
+
+	p("<!DOCTYPE html>")
+	p(`<html><head><meta charset="utf-8"><title>%s</title>`, esc(title))
+	p(`<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: left; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; }
+svg { display: block; margin: 1.5em 0; }
+</style></head><body>`)
+	p("<h1>%s</h1>", esc(title))
+	p("<p>Generated %s from %d runs.</p>", time.Now().Format(time.RFC1123), len(runs))
+
+	p("<h2>Runs</h2>")
+	p("<table><tr><th>run</th><th>backend</th><th>path</th><th>scenario</th><th>scan</th><th>writers</th><th>readers</th><th>start</th><th>duration</th><th>row sets</th><th>rows</th><th>inter-arrival</th></tr>")
+	for _, run := range runs {
+		r := run.r
+		scenario := ""
+		if r.Scenario != nil {
+			scenario = r.Scenario.Name
+		}
+		p("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td></tr>",
+			esc(run.name), esc(r.Id), esc(r.Path), esc(scenario), esc(r.Scan), r.Writers, r.Readers,
+			r.Start.Format(time.RFC3339), r.End.Sub(r.Start).Round(time.Millisecond), r.RowSets, r.Rows, r.Arrival)
+	}
+	p("</table>")
+
+	p("<h2>Hosts and options</h2>")
+	p("<table><tr><th>run</th><th>host</th><th>cpu</th><th>cpus</th><th>kernel</th><th>os</th><th>filesystem</th><th>go</th><th>gomaxprocs</th><th>commit</th><th>data</th><th>options</th></tr>")
+	for _, run := range runs {
+		m := run.r.meta()
+		commit := m.Commit
+		if m.Modified {
+			commit += " (modified)"
+		}
+		data := ""
+		if m.Data != nil {
+			data = fmt.Sprintf("%s, %d bytes, sha256 %s", m.Data.Path, m.Data.Size, m.dataDigest())
+		}
+		keys := make([]string, 0, len(m.Options))
+		for k := range m.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		opts := make([]string, len(keys))
+		for i, k := range keys {
+			opts[i] = "-" + k + "=" + m.Options[k]
+		}
+		p("<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+			esc(run.name), esc(m.Hostname), esc(m.CPU), m.CPUs, esc(m.Kernel), esc(strings.Trim(m.OS+"/"+m.Arch, "/")),
+			esc(m.Filesystem), esc(m.GoVersion), m.GOMAXPROCS, esc(commit), esc(data), esc(strings.Join(opts, " ")))
+	}
+	p("</table>")
+
+	p("<h2>Over time</h2>")
+	formatX := func(v float64) string { return time.Duration(v).Round(time.Millisecond).String() }
+	for _, l := range reportLines {
+		c := &lineChart{Title: l.title, FormatX: formatX, FormatY: l.format}
+		for _, run := range runs {
+			if s := seriesOf(run, run.name, false, l.values); len(s.X) > 0 {
+				c.Series = append(c.Series, s)
+			}
+		}
+		if len(c.Series) > 0 {
+			buf.WriteString(c.svg())
+		}
+	}
+
+	c := &lineChart{Title: "Set latency p50 and p99", FormatX: formatX, FormatY: formatDuration}
+	for _, run := range runs {
+		for _, q := range []struct {
+			name string
+			dash bool
+			fn   func(l *Latency) time.Duration
+		}{
+			{"p50", false, func(l *Latency) time.Duration { return l.P50 }},
+			{"p99", true, func(l *Latency) time.Duration { return l.P99 }},
+		} {
+			fn := q.fn
+			s := seriesOf(run, run.name+" "+q.name, q.dash, func(p PollRecord) (float64, bool) {
+				if p.SetLatency == nil {
+					return 0, false
+				}
+				return float64(fn(p.SetLatency)), true
+			})
+			if len(s.X) > 0 {
+				c.Series = append(c.Series, s)
+			}
+		}
+	}
+	if len(c.Series) > 0 {
+		buf.WriteString(c.svg())
+	}
+
+	p("<h2>Comparison</h2>")
+	for _, name := range reportBars {
+		m := compareMetricNamed(name)
+		bc := &barChart{Title: "Median " + name, Format: m.format}
+		for _, g := range groups {
+			if xs := g.trials(m); len(xs) > 0 {
+				bc.Names = append(bc.Names, g.Name)
+				bc.Values = append(bc.Values, Median(xs))
+			}
+		}
+		if len(bc.Names) > 0 {
+			buf.WriteString(bc.svg())
+		}
+	}
+
+	if len(groups) > 1 {
+		table := &bytes.Buffer{}
+		if err = CompareResults(table, groups, 0.05); err != nil {
+			return
+		}
+		p("<pre>%s</pre>", esc(table.String()))
+	}
+
+	p("</body></html>")
+	_, err = w.Write(buf.Bytes())
+	return
+}
+
+// compareMetricNamed returns the compareMetric called name.
+func compareMetricNamed(name string) compareMetric {
+	for _, m := range compareMetrics {
+		if m.name == name {
+			return m
+		}
+	}
+	panic("unknown compare metric " + name)
+}
+
+func reportCommand(args []string) (err error) {
+	var output, title string
+
+	fs := newFlagSet("report", reportUsage)
+	fs.StringVar(&output, "o", "report.html", "output path for the report")
+	fs.StringVar(&title, "title", "kvbench report", "title of the report")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return usageError{fmt.Errorf("at least one results file is required")}
+	}
+
+	groups := make([]*ResultsGroup, fs.NArg())
+	for i, pattern := range fs.Args() {
+		if groups[i], err = readResultsGroup(pattern); err != nil {
+			return
+		}
+	}
+
+	fh, err := os.Create(output)
+	if err != nil {
+		return
+	}
+	err = WriteReport(fh, title, groups)
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.Printf("wrote report of %s to %s\n", strings.Join(fs.Args(), ", "), output)
+	}
+	return
+}
@@ -0,0 +1,798 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var runUsage = `USAGE:
+
+kvbench run OPTIONS -i dat -b bench -f path
+kvbench run -scenario file [-results file] [-trace file] [-replay file]
+                        [-metrics-addr addr]
+
+Replay the data file -i into the -b benchmark's database at -f path,
+one block per row set, while polling the database.  Each poll
+iterates over the keys and reports how long that took, the size and
+number of files under the -f path, the write and space amplification
+of the data written so far, and the CPU time, resident memory, GC
+activity and allocations of the process since the previous poll.
+Backends that expose internal statistics (bolt freelist and
+transaction counters, leveldb compaction and I/O counters, kv file
+size) report them with the change since the previous poll.
+
+SIGINT or SIGTERM stops sending row sets, lets the writers finish,
+and writes the final poll, summary and results of the run before
+closing the database; a second signal exits at once.
+
+OPTIONS
+
+-r n    - pseudo-random seed; the data file, inter-arrival times and
+          the -shuffle order are each drawn from an independent
+          stream of the seed, so runs with the same seed and data
+          send the same row sets after the same delays
+-d0 dur - minimum inter-arrival rate
+-d1 dur - maximum inter-arrival rate (not guaranteed)
+-p dur  - poll db at this interval and print statistics
+
+-i dat   - input path for data file
+-b bench - name of the benchmark to run (badger, bbolt, bolt, kv,
+           kv-mu, leveldb, noop, pebble, sqlite), or of an in-memory
+           reference collection (btree, map, skiplist), or resp for
+           a remote server speaking the Redis protocol, or remote
+           for a collection served by kvbench serve; or a comma
+           separated list of benchmarks, or all for every benchmark
+           but resp and remote, to run each in turn against a fresh
+           temporary database with the same data and seed, and
+           print a table comparing them
+-f path  - path to the database, or host:port for resp and remote;
+           not needed by the in-memory collections and noop; with
+           several benchmarks, the directory to create temporary
+           databases in, by default the system temporary directory
+
+-duration dur - stop writing after dur, or 0 to replay the whole
+                data file
+-writers n    - number of goroutines writing row sets
+-readers n    - number of scans run concurrently at each poll
+-max-errors n - number of failed writes to skip before failing the
+                run, default 0: the first failed write stops the
+                run, which writes its results, including the
+                error, and exits with status 1
+
+-results file - write the measurements of every poll to file as
+                JSON, for kvbench compare, along with the host,
+                build, options and data file of the run; with
+                several benchmarks the id of each is inserted
+                before the extension
+-trace file   - record every row set sent and written, poll and
+                scan of the run to file, one JSON object per line,
+                with its time since the start of the run; with
+                several benchmarks or trials the id or trial is
+                inserted as it is for -results
+-replay file  - replay a trace written by -trace: send as many row
+                sets as the traced run did, after the same
+                inter-arrival times, and poll at the same times,
+                in place of -r, -d0, -d1, -p and -duration.  With
+                more than one writer the order in which concurrent
+                writes complete is traced but not replayed
+-tui          - show a live dashboard of the run, refreshed every
+                second, in place of the log: the arrival rate of
+                row sets against the target, the writer backlog,
+                write and scan throughput and latency percentiles,
+                disk usage, memory and GC
+
+-metrics-addr addr - serve the counters and histograms of the run at
+                     http://addr/metrics in the Prometheus text
+                     format, or OpenMetrics when asked for, labeled
+                     by backend id and scenario name
+
+-count n   - run each benchmark n times, each time against a fresh
+             temporary database, and summarize every measurement
+             across the trials; -f is then the directory to create
+             the databases in, except for resp and remote, which
+             run against their server each time; the trial number
+             is inserted before the extension of each -results file
+-shuffle   - shuffle the order of the benchmarks in each trial
+
+-scenario file - run the JSON scenario in file instead of taking
+                 options from the command line; only -results,
+                 -trace, -replay and -metrics-addr may be given
+                 with it
+
+-sqlite-journal mode - sqlite journal_mode: wal, delete, truncate,
+             persist, memory, off
+-sqlite-sync level   - sqlite synchronous level: off, normal, full,
+             extra
+
+-scan mode - how each poll iterates over the database:
+             rows   - decode every row and pass it through a channel
+             raw    - visit each key and value without copying
+             copy   - copy each key and value
+             decode - decode each key and value, spending -scan-cost
+                      rounds of simulated work per byte
+-scan-cost n - rounds of simulated work per byte in decode mode
+-scan-timeout dur - stop each scan after dur, or 0 (the default) for
+             no limit; the rows visited until then are counted and
+             the timeouts are reported with each poll
+
+FAULT INJECTION OPTIONS
+
+-fault spec     - fail database file writes on a schedule, where spec
+                  is kind@after or kind@after/every and kind is one
+                  of enospc, eio or short (torn write); supported by
+                  bbolt, bolt, kv, kv-mu and leveldb
+-fault-fsize n  - limit database files to n bytes, so that writes
+                  past that size fail with EFBIG as on a full disk
+                  (all backends except noop); for badger, pebble
+                  and sqlite the limit is RLIMIT_FSIZE, which
+                  applies to every file kvbench writes, and so
+                  cannot be combined with -trace
+-fault-timeout dur - how long to wait for the writer to finish
+                  after a fault before reporting a hang
+
+When a fault option is given the benchmark reports whether the
+backend returned an error, hung, or lost or corrupted rows it had
+acknowledged, by reopening the database without faults.
+
+SCENARIOS
+
+A scenario file describes a run as JSON, so that it can be checked in
+and reviewed.  It may name several backends, which are run one after
+the other against the same data with the same seed; give each a
+distinct name to run one backend with several sets of options.
+Fields that are not given take the defaults of the options above;
+unknown fields are rejected.  Relative paths are resolved against the
+directory of the scenario file.  The optional trace and replay fields
+are the -trace and -replay options, which override them.  A backend
+without a path runs against a fresh temporary database.  The scenario
+is recorded in the results, and with more than one backend a table
+comparing them is printed.
+
+{
+  "name": "bolt-vs-leveldb",
+  "seed": 5,
+  "data": {
+    "path": "sample.dat",
+    "generate": {"blocks": 100, "block_min": 0, "block_max": 4000,
+                 "key_min": 34, "key_max": 34,
+                 "value_min": 70, "value_max": 78}
+  },
+  "arrival": {"min": "50ms", "max": "175ms"},
+  "poll": "10s",
+  "duration": "0s",
+  "writers": 1,
+  "readers": 1,
+  "max_errors": 0,
+  "scan": {"mode": "rows", "cost": 0, "timeout": "0s"},
+  "count": 1,
+  "shuffle": false,
+  "backends": [
+    {"id": "bolt", "path": "test/bolt.db"},
+    {"id": "sqlite", "path": "test/sqlite.db",
+     "options": {"journal": "wal", "sync": "normal"}}
+  ],
+  "results": "results.json"
+}
+
+When data has a generate section the data file is generated before
+the run.  With more than one backend the results are written to one
+file per backend, named by inserting the backend id before the
+extension: results.bolt.json, results.sqlite.json, or the name of
+the backend when it has one.
+`
+
+// runConfig holds the options of kvbench run.
+type runConfig struct {
+	seed    int64
+	d0, d1  time.Duration
+	p       time.Duration
+	input   string
+	id      string
+	path    string
+	results string
+
+	duration time.Duration
+	writers  int
+	readers  int
+	maxErrs  int
+	trace    string // records the operations of the run, if not ""
+	replay   string // trace whose schedule is replayed, if not ""
+	tui      bool
+	metrics  *Metrics   // serves the metrics of the run, if not nil
+	stop     *interrupt // stops the run on a signal, if not nil
+
+	fresh      bool              // run against a temporary database created under path, if id keeps one on disk
+	collection CollectionOptions // backend options
+	scenario   *Scenario         // recorded in the results, if not nil
+	options    map[string]string // the flags of the invocation, recorded in the metadata
+	data       *DataFile         // the data file, described once for every run
+
+	scanMode    string
+	scanCost    int
+	scanTimeout time.Duration
+
+	faultSpec     string
+	faultFileSize int64
+	faultTimeout  time.Duration
+}
+
+var runFlags = []string{
+	"d0", "d1", "p", "i", "b", "f", "results", "duration", "writers", "readers", "max-errors",
+	"trace", "replay", "tui",
+	"sqlite-journal", "sqlite-sync", "scan", "scan-cost", "scan-timeout",
+	"fault", "fault-fsize", "fault-timeout",
+}
+
+// scenarioFlags are the options that may be given
+// with -scenario, overriding the scenario's fields.
+var scenarioFlags = []string{"scenario", "results", "trace", "replay", "metrics-addr"}
+
+// flags registers every option except the seed with fs.
+func (c *runConfig) flags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.d0, "d0", 500*time.Millisecond, "minimum inter-arrival rate")
+	fs.DurationVar(&c.d1, "d1", time.Second, "maximum inter-arrival rate (not guaranteed)")
+	fs.DurationVar(&c.p, "p", 10*time.Second, "poll db at this interval and print statistics")
+	fs.StringVar(&c.input, "i", "", "input path for data")
+	fs.StringVar(&c.id, "b", "", "benchmark id: "+strings.Join(collectionIds, ", "))
+	fs.StringVar(&c.path, "f", "", "database path, or host:port for resp and remote")
+	fs.StringVar(&c.results, "results", "", "output path for results")
+	fs.DurationVar(&c.duration, "duration", 0, "stop writing after this long, 0 to replay the whole data file")
+	fs.IntVar(&c.writers, "writers", 1, "number of goroutines writing row sets")
+	fs.IntVar(&c.readers, "readers", 1, "number of concurrent scans at each poll")
+	fs.IntVar(&c.maxErrs, "max-errors", 0, "number of failed writes to skip before failing the run")
+	fs.StringVar(&c.trace, "trace", "", "output path for a trace of the run's operations")
+	fs.StringVar(&c.replay, "replay", "", "replay the arrival and poll schedule of a trace")
+	fs.BoolVar(&c.tui, "tui", false, "show a live dashboard of the run")
+	sqliteFlags(fs, &c.collection.SQLite)
+	fs.StringVar(&c.scanMode, "scan", "rows", "scan mode: rows, raw, copy, decode")
+	fs.IntVar(&c.scanCost, "scan-cost", 0, "rounds of simulated work per byte in decode scan mode")
+	fs.DurationVar(&c.scanTimeout, "scan-timeout", 0, "stop each scan after this long, 0 for no limit")
+
+	fs.StringVar(&c.faultSpec, "fault", "", "database file write fault schedule for bbolt, bolt, kv, kv-mu and leveldb: kind@after[/every]")
+	fs.Int64Var(&c.faultFileSize, "fault-fsize", 0, "database file size limit in bytes")
+	fs.DurationVar(&c.faultTimeout, "fault-timeout", 30*time.Second, "time to wait for the writer after a fault")
+}
+
+// owns reports whether the flag name is a run option.
+func (c *runConfig) owns(name string) bool {
+	return contains(runFlags, name)
+}
+
+func (c *runConfig) validate() (err error) {
+	switch {
+	case c.input == "":
+		return fmt.Errorf("missing required -i <dat> argument")
+	case c.id == "":
+		return fmt.Errorf("missing required -b <benchmarkId> argument")
+	case !contains(collectionIds, c.id):
+		return fmt.Errorf("unknown benchmark id: %s", c.id)
+	case c.path == "" && !contains(memoryIds, c.id) && !c.fresh:
+		return fmt.Errorf("missing required -f <database> argument")
+	case c.d0 < 0 || c.d1 < c.d0:
+		return fmt.Errorf("invalid inter-arrival rate -d0 %s -d1 %s", c.d0, c.d1)
+	case c.p <= 0:
+		return fmt.Errorf("invalid poll interval -p %s", c.p)
+	case c.duration < 0:
+		return fmt.Errorf("invalid -duration %s", c.duration)
+	case c.writers < 1:
+		return fmt.Errorf("invalid -writers %d", c.writers)
+	case c.readers < 1:
+		return fmt.Errorf("invalid -readers %d", c.readers)
+	case c.maxErrs < 0:
+		return fmt.Errorf("invalid -max-errors %d", c.maxErrs)
+	case c.scanCost < 0:
+		return fmt.Errorf("invalid -scan-cost %d", c.scanCost)
+	case c.scanTimeout < 0:
+		return fmt.Errorf("invalid -scan-timeout %s", c.scanTimeout)
+	case c.faultFileSize < 0:
+		return fmt.Errorf("invalid -fault-fsize %d", c.faultFileSize)
+	case c.faultTimeout <= 0:
+		return fmt.Errorf("invalid -fault-timeout %s", c.faultTimeout)
+	case c.trace != "" && c.faultFileSize > 0 && !contains(faultIds, c.id):
+		return fmt.Errorf("-trace cannot be combined with -fault-fsize for %s, whose limit applies to every file kvbench writes", c.id)
+	case c.trace != "" && c.trace == c.replay:
+		return fmt.Errorf("-trace and -replay name the same file %s", c.trace)
+	}
+
+	if _, err = ParseScanMode(c.scanMode); err != nil {
+		return
+	}
+	if c.faultSpec != "" {
+		if _, err = ParseFaultSchedule(c.faultSpec); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// faulty reports whether the run injects faults.
+func (c *runConfig) faulty() bool {
+	return c.faultSpec != "" || c.faultFileSize > 0
+}
+
+// flagValues returns the value of each flag visited by
+// visit, such as fs.Visit or fs.VisitAll, by name.
+func flagValues(visit func(func(*flag.Flag))) map[string]string {
+	m := make(map[string]string)
+	visit(func(f *flag.Flag) {
+		m[f.Name] = f.Value.String()
+	})
+	return m
+}
+
+// describeData describes the data file of the run, unless
+// it already has been, so that repeated runs of one
+// invocation read it once.
+func (c *runConfig) describeData() {
+	if c.data != nil {
+		return
+	}
+	d, err := ReadDataFile(c.input)
+	if err != nil {
+		log.Printf("unable to describe data file: %v\n", err)
+		return
+	}
+	c.data = d
+}
+
+// metadata describes the host and build the run is made
+// on, its options, named as the flags that set them, and
+// its data file.
+func (c *runConfig) metadata() *Metadata {
+	m := CollectMetadata(c.path)
+	m.Options = make(map[string]string, len(c.options))
+	for k, v := range c.options {
+		m.Options[k] = v
+	}
+
+	// the options that differ between the runs of
+	// one invocation, or that are set by a scenario
+	m.Options["r"] = strconv.FormatInt(c.seed, 10)
+	m.Options["b"] = c.id
+	m.Options["f"] = c.path
+	m.Options["results"] = c.results
+	m.Options["trace"] = c.trace
+	m.Options["sqlite-journal"] = c.collection.SQLite.withDefaults().Journal
+	m.Options["sqlite-sync"] = c.collection.SQLite.withDefaults().Synchronous
+	if c.metrics != nil {
+		m.Options["metrics-addr"] = c.metrics.Addr().String()
+	}
+
+	c.describeData()
+	m.Data = c.data
+	return m
+}
+
+// run replays the data file into the benchmark, with
+// inter-arrival times drawn from the arrival stream of the
+// seed or taken from the -replay trace, and returns the
+// benchmark's results, or nil for a fault injection run.
+func (c *runConfig) run() (r *Results, err error) {
+	if c.fresh && !contains(memoryIds, c.id) && !contains(serverIds, c.id) {
+		dir, err := ioutil.TempDir(c.path, "kvbench-"+c.id+"-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		fc := *c
+		fc.fresh, fc.path = false, filepath.Join(dir, c.id)
+		return fc.run()
+	}
+
+	fh, err := os.Open(c.input)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	var deadline time.Time
+	var polls []time.Duration
+	next := NewStream(c.seed, "arrival").arrivals(c.d0, c.d1)
+	if c.replay != "" {
+		sched, err := ReadSchedule(c.replay)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("replaying %d row sets and %d polls from %s\n", sched.Sends, len(sched.Polls), c.replay)
+		next, polls = sched.arrivals(), sched.Polls
+	}
+
+	var tr *Trace
+	if c.trace != "" {
+		if tr, err = CreateTrace(c.trace); err != nil {
+			return
+		}
+		defer func() {
+			if terr := tr.Close(); err == nil && terr != nil {
+				err = fmt.Errorf("unable to write trace %s: %v", c.trace, terr)
+			}
+		}()
+	}
+
+	if c.faulty() {
+		return nil, c.runFaultTest(next, fh, tr)
+	}
+
+	mode, err := ParseScanMode(c.scanMode)
+	if err != nil {
+		return
+	}
+
+	benchmark, err := NewBenchmark(c.id, c.path, &c.collection)
+	if err != nil {
+		return
+	}
+	benchmark.SetScan(Scan{Mode: mode, Cost: c.scanCost})
+	benchmark.SetScanTimeout(c.scanTimeout)
+	benchmark.SetConcurrency(c.writers, c.readers)
+	benchmark.SetMaxErrors(c.maxErrs)
+	benchmark.SetTrace(tr)
+	benchmark.SetPolls(polls)
+	benchmark.Results().Scenario = c.scenario
+	benchmark.Results().Metadata = c.metadata()
+
+	ch := make(chan []*Row, 100)
+
+	benchmark.Run(ch, c.p)
+	c.stop.setForce(func() error { return benchmark.Close(true) })
+	defer c.stop.setForce(nil)
+	if c.metrics != nil {
+		var name string
+		if c.scenario != nil {
+			name = c.scenario.Name
+		}
+		c.metrics.Set(benchmark, name)
+		defer c.metrics.Set(nil, "")
+	}
+	if c.tui {
+		d := NewDashboard(os.Stdout, benchmark, c.id, (c.d0+c.d1)/2)
+		defer d.Start(time.Second)()
+	}
+
+	if c.duration > 0 && c.replay == "" {
+		deadline = time.Now().Add(c.duration)
+	}
+
+	// stop sending on a signal, or when the writers fail
+	stop, sent := make(chan bool), make(chan bool)
+	go func() {
+		select {
+		case <-c.stop.done():
+		case <-benchmark.Failed():
+		case <-sent:
+		}
+		close(stop)
+	}()
+
+	log.Printf("reading data from %s\n", c.input)
+	err = sendRows(ch, fh, next, deadline, stop, tr)
+	close(sent)
+	if err != nil && err != io.EOF {
+		log.Println(err)
+	}
+	err = nil
+
+	interrupted := c.stop.stopped()
+	if interrupted || benchmark.Err() != nil {
+		log.Printf("%s: discarded %d queued row sets, waiting for the writers\n", c.id, drain(ch))
+	}
+	close(ch)
+
+	benchmark.Wait()
+
+	r = benchmark.Results()
+	r.Interrupted = interrupted
+	log.Println(r.Summary())
+	if c.results != "" {
+		log.Printf("writing results to %s\n", c.results)
+		err = r.WriteFile(c.results)
+	}
+	if cerr := benchmark.Close(false); err == nil {
+		err = cerr
+	}
+	if werr := benchmark.Err(); werr != nil {
+		return r, fmt.Errorf("write failed: %v", werr)
+	}
+	if interrupted && err == nil {
+		err = errInterrupted
+	}
+	return
+}
+
+// drain discards the row sets queued on ch, returning
+// how many there were.
+func drain(ch chan []*Row) (n int) {
+	for {
+		select {
+		case <-ch:
+			n++
+		default:
+			return
+		}
+	}
+}
+
+// runTrials runs each configuration count times, each run
+// against a fresh database when count is more than one, and
+// each drawing from the same streams of its seed so that every
+// run sees the same arrival times.  With shuffle the order of
+// the configurations is shuffled in every trial, from the
+// shuffle stream of the first configuration's seed.  It then prints
+// a summary of each configuration's trials and a table
+// comparing the configurations.  A run that fails is logged
+// and the rest are still run, but the whole fails.  A run
+// stopped by a signal is summarized with the others, but
+// no further runs are made.
+func runTrials(configs []*runConfig, labels []string, count int, shuffle bool) (err error) {
+	groups := make([]*ResultsGroup, len(configs))
+	for i := range configs {
+		groups[i] = &ResultsGroup{Name: labels[i]}
+	}
+
+	order := make([]int, len(configs))
+	for i := range order {
+		order[i] = i
+	}
+	shuffler := NewStream(configs[0].seed, "shuffle")
+
+	var failed []string
+	var interrupted bool
+trials:
+	for trial := 1; trial <= count; trial++ {
+		if shuffle {
+			shuffler.Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+		}
+
+		for n, i := range order {
+			if configs[i].stop.stopped() {
+				interrupted = true
+				break trials
+			}
+			c, label := configs[i], labels[i]
+			if count > 1 {
+				label = fmt.Sprintf("%s trial %d", labels[i], trial)
+				rc := *c
+				// a server's database cannot be recreated
+				rc.fresh = !contains(serverIds, c.id)
+				if c.results != "" {
+					rc.results = resultsPath(c.results, strconv.Itoa(trial))
+				}
+				if c.trace != "" {
+					rc.trace = resultsPath(c.trace, strconv.Itoa(trial))
+				}
+				c = &rc
+			}
+
+			log.Printf("running %s (%d of %d)\n", label, (trial-1)*len(order)+n+1, count*len(order))
+			r, err := c.run()
+			if err == errInterrupted {
+				if r != nil {
+					groups[i].Results = append(groups[i].Results, r)
+				}
+				interrupted = true
+				break trials
+			}
+			if err != nil {
+				log.Printf("%s: %v\n", label, err)
+				failed = append(failed, label)
+				continue
+			}
+			if r != nil {
+				groups[i].Results = append(groups[i].Results, r)
+			}
+		}
+	}
+
+	var ran []*ResultsGroup
+	for _, g := range groups {
+		if len(g.Results) > 0 {
+			ran = append(ran, g)
+		}
+	}
+
+	if count > 1 {
+		for _, g := range ran {
+			fmt.Println()
+			if err = SummarizeTrials(os.Stdout, g); err != nil {
+				return
+			}
+		}
+	}
+	if len(ran) > 1 {
+		fmt.Println()
+		if err = CompareResults(os.Stdout, ran, 0.05); err != nil {
+			return
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d runs failed: %s",
+			len(failed), count*len(configs), strings.Join(failed, ", "))
+	}
+	if interrupted {
+		return errInterrupted
+	}
+	return nil
+}
+
+// parseBackendIds parses the -b option: one benchmark id,
+// a comma separated list of ids, or all.
+func parseBackendIds(s string) (ids []string, err error) {
+	if s == "all" {
+		for _, id := range collectionIds {
+			if id != "remote" && id != "resp" {
+				ids = append(ids, id)
+			}
+		}
+		return
+	}
+
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		switch {
+		case id == "":
+			continue
+		case !contains(collectionIds, id):
+			return nil, fmt.Errorf("unknown benchmark id: %s", id)
+		case contains(ids, id):
+			return nil, fmt.Errorf("benchmark id %s listed twice", id)
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) > 1 && (contains(ids, "remote") || contains(ids, "resp")) {
+		return nil, fmt.Errorf("remote and resp cannot be run with other benchmarks")
+	}
+	return
+}
+
+// resultsPath returns the results file for the backend
+// labeled label when several are run: results.json
+// becomes results.bolt.json, results.leveldb.json, ...
+func resultsPath(path, label string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + label + ext
+}
+
+// runFaultTest replays the data in r against the benchmark,
+// waiting the inter-arrival times returned by next, with the
+// configured faults injected and logs the outcome.  Only the
+// row sets sent are traced to tr.
+func (c *runConfig) runFaultTest(next func() (time.Duration, bool), r io.Reader, tr *Trace) (err error) {
+	ft := &FaultTest{
+		Id:       c.id,
+		Path:     c.path,
+		FileSize: c.faultFileSize,
+		Timeout:  c.faultTimeout,
+		Options:  &c.collection,
+	}
+
+	if c.faultSpec != "" {
+		ft.Schedule, err = ParseFaultSchedule(c.faultSpec)
+		if err != nil {
+			return
+		}
+	}
+
+	log.Printf("reading data from %s\n", c.input)
+	report, err := ft.Run(func(ch chan []*Row, stop <-chan bool) error {
+		return sendRows(ch, r, next, time.Time{}, stop, tr)
+	}, c.p)
+	if err != nil {
+		return
+	}
+
+	log.Println(report)
+	return nil
+}
+
+func runCommand(args []string) (err error) {
+	c := &runConfig{}
+	var scenario string
+	var count int
+	var shuffle bool
+	var metricsAddr string
+
+	fs := newFlagSet("run", runUsage)
+	fs.Int64Var(&c.seed, "r", 0, "pseudo random seed")
+	c.flags(fs)
+	fs.StringVar(&scenario, "scenario", "", "path to a JSON scenario")
+	fs.IntVar(&count, "count", 1, "number of times to run each benchmark")
+	fs.BoolVar(&shuffle, "shuffle", false, "shuffle the order of the benchmarks in each trial")
+	fs.StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics at this address")
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	c.options = flagValues(fs.VisitAll)
+
+	c.stop = notifyInterrupt()
+	defer c.stop.release()
+
+	if metricsAddr != "" {
+		if c.metrics, err = ListenMetrics(metricsAddr); err != nil {
+			return
+		}
+		defer c.metrics.Close()
+	}
+
+	if scenario != "" {
+		fs.Visit(func(f *flag.Flag) {
+			if !contains(scenarioFlags, f.Name) && err == nil {
+				err = usageError{fmt.Errorf("-%s cannot be combined with -scenario", f.Name)}
+			}
+		})
+		if err != nil {
+			return
+		}
+
+		s, err := LoadScenario(scenario)
+		if err != nil {
+			return err
+		}
+		if c.results != "" {
+			s.Results = c.results
+		}
+		if c.trace != "" {
+			s.Trace = c.trace
+		}
+		if c.replay != "" {
+			s.Replay = c.replay
+		}
+		// the overrides are checked as the scenario's
+		// own fields were
+		if err = s.Validate(); err != nil {
+			return usageError{fmt.Errorf("invalid scenario %s: %v", scenario, err)}
+		}
+		s.metrics, s.stop = c.metrics, c.stop
+		// the scenario is recorded with the results,
+		// so only the flags given with it are options
+		s.options = flagValues(fs.Visit)
+		return s.Run()
+	}
+
+	if count < 1 {
+		return usageError{fmt.Errorf("invalid -count %d", count)}
+	}
+
+	ids, err := parseBackendIds(c.id)
+	if err != nil {
+		return usageError{err}
+	}
+	if len(ids) < 2 && count == 1 {
+		if err = c.validate(); err != nil {
+			return usageError{err}
+		}
+		_, err = c.run()
+		return
+	}
+
+	c.describeData()
+
+	configs := make([]*runConfig, len(ids))
+	for i, id := range ids {
+		rc := *c
+		rc.id, rc.fresh = id, true
+		if c.results != "" && len(ids) > 1 {
+			rc.results = resultsPath(c.results, id)
+		}
+		if c.trace != "" && len(ids) > 1 {
+			rc.trace = resultsPath(c.trace, id)
+		}
+		if err = rc.validate(); err != nil {
+			return usageError{fmt.Errorf("%s: %v", id, err)}
+		}
+		configs[i] = &rc
+	}
+	return runTrials(configs, ids, count, shuffle)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+)
+
+var serveUsage = `USAGE:
+
+kvbench serve -b bench -f path -addr host:port
+
+Open the -b benchmark's collection at -f path and serve it over HTTP
+at -addr, so that a benchmark run elsewhere with -b remote -f
+host:port measures the store in a separate process from the load
+generator.
+
+OPTIONS
+
+-b bench       - name of the benchmark whose collection to serve
+-f path        - path to the database
+-addr host:port - address to listen on
+
+-sqlite-journal mode - sqlite journal_mode
+-sqlite-sync level   - sqlite synchronous level
+`
+
+// serveCommand implements the serve subcommand, exposing
+// a collection to remote benchmarks.
+func serveCommand(args []string) (err error) {
+	fs := newFlagSet("serve", serveUsage)
+	id := fs.String("b", "", "benchmark id of the collection to serve")
+	path := fs.String("f", "", "database path")
+	addr := fs.String("addr", "127.0.0.1:7070", "address to listen on")
+	var opts CollectionOptions
+	sqliteFlags(fs, &opts.SQLite)
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	switch {
+	case *id == "":
+		return usageError{fmt.Errorf("missing required -b <benchmarkId> argument")}
+	case *id == "remote" || !contains(collectionIds, *id):
+		return usageError{fmt.Errorf("unable to serve benchmark id: %s", *id)}
+	case *path == "" && !contains(memoryIds, *id):
+		return usageError{fmt.Errorf("missing required -f <database> argument")}
+	}
+
+	c, err := openCollection(*id, *path, true, &opts)
+	if err != nil {
+		return
+	}
+	defer c.Close(true)
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return
+	}
+
+	log.Printf("serving %s at %s\n", *id, l.Addr())
+	return ServeCollection(l, c)
+}
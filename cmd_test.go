@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateConfigValidate(t *testing.T) {
+	valid := generateConfig{blocks: 10, b0: 1, b1: 10, k0: 4, k1: 8, v0: 0, v1: 16, output: "x.dat"}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, fn := range []func(c *generateConfig){
+		func(c *generateConfig) { c.output = "" },
+		func(c *generateConfig) { c.blocks = -1 },
+		func(c *generateConfig) { c.b0 = 11 },
+		func(c *generateConfig) { c.k0 = 0 },
+		func(c *generateConfig) { c.k1 = 3 },
+		func(c *generateConfig) { c.v0 = -1 },
+	} {
+		c := valid
+		fn(&c)
+		if err := c.validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestRunConfigValidate(t *testing.T) {
+	valid := runConfig{
+		d0: time.Millisecond, d1: time.Second, p: time.Second,
+		input: "x.dat", id: "bolt", path: "x.db",
+		scanMode: "rows", faultTimeout: time.Second,
+		writers: 1, readers: 1,
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	c := valid
+	c.id, c.path = "map", ""
+	if err := c.validate(); err != nil {
+		t.Errorf("unexpected error for an in-memory collection: %v", err)
+	}
+
+	for _, fn := range []func(c *runConfig){
+		func(c *runConfig) { c.input = "" },
+		func(c *runConfig) { c.id = "" },
+		func(c *runConfig) { c.id = "nosuchdb" },
+		func(c *runConfig) { c.path = "" },
+		func(c *runConfig) { c.d1 = 0 },
+		func(c *runConfig) { c.p = 0 },
+		func(c *runConfig) { c.writers = 0 },
+		func(c *runConfig) { c.scanMode = "sideways" },
+		func(c *runConfig) { c.faultSpec = "eio@" },
+	} {
+		c := valid
+		fn(&c)
+		if err := c.validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+
+	if !c.owns("b") || c.owns("b0") {
+		t.Errorf("expected -b to be a run option and -b0 not to be")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := NewRandom(7).Write(buf, 20, 1, 50, 2, 3, 1, 16); err != nil {
+		t.Fatal(err)
+	}
+	dat := buf.Bytes()
+
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := NewRandom(7)
+	ch := make(chan []*Row, 100)
+	go func() {
+		rnd.Send(ch, bytes.NewReader(dat), 0, 0)
+		close(ch)
+	}()
+	for rows := range ch {
+		if err := c.Set(context.Background(), rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Verify(context.Background(), c, bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Ok() || report.Found != report.Expected || report.Expected == 0 {
+		t.Errorf("expected a matching database, got %s", report)
+	}
+
+	var first []byte
+	c.ForEach(context.Background(), func(k, v []byte) error {
+		first = append([]byte(nil), k...)
+		return io.EOF
+	})
+	c.Delete(context.Background(), RowKey{b: first})
+	c.Set(context.Background(), []*Row{{Key: RowKey{b: []byte("extra")}, Value: &RowValue{b: []byte("v")}}})
+
+	report, err = Verify(context.Background(), c, bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok() || report.Missing != 1 || report.Unexpected != 1 {
+		t.Errorf("expected 1 missing and 1 unexpected row, got %s", report)
+	}
+}
+
+func TestVerifyMissingDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvbench.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dat := filepath.Join(dir, "test.dat")
+	if err = ioutil.WriteFile(dat, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"bolt", "leveldb"} {
+		path := filepath.Join(dir, id+".db")
+		for _, cmd := range []func([]string) error{verifyCommand, inspectCommand} {
+			err = cmd([]string{"-i", dat, "-b", id, "-f", path})
+			if err == nil || !strings.Contains(err.Error(), "no "+id+" database") {
+				t.Errorf("%s: expected a missing database error, got %v", id, err)
+			}
+		}
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no database to be created, got %v", id, err)
+		}
+	}
+}
+
+func TestSummarizeData(t *testing.T) {
+	fh, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	c := &generateConfig{blocks: 5, b0: 2, b1: 4, k0: 8, k1: 8, v0: 10, v1: 20, output: fh.Name()}
+	if err = c.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := SummarizeData(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Blocks != 5 || s.Block.min < 2 || s.Block.max > 4 {
+		t.Errorf("unexpected blocks: %s", s)
+	}
+	if s.KeyLen.min != 8 || s.KeyLen.max != 8 {
+		t.Errorf("unexpected key lengths: %s", s)
+	}
+	if s.ValueLen.min < 10 || s.ValueLen.max > 20 {
+		t.Errorf("unexpected value lengths: %s", s)
+	}
+	if !strings.HasPrefix(s.String(), "5 blocks") {
+		t.Errorf("unexpected summary: %s", s)
+	}
+
+	if _, err = SummarizeData(strings.NewReader("\x02")); err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+}
+
+func TestParseBackendIds(t *testing.T) {
+	ids, err := parseBackendIds("bolt, leveldb,kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, " ") != "bolt leveldb kv" {
+		t.Errorf("unexpected ids: %v", ids)
+	}
+
+	ids, err = parseBackendIds("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(collectionIds)-2 || contains(ids, "remote") || contains(ids, "resp") {
+		t.Errorf("expected every local benchmark, got %v", ids)
+	}
+
+	for _, bad := range []string{"bolt,nosuchdb", "bolt,bolt", "bolt,remote"} {
+		if _, err = parseBackendIds(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestRunTrialsFresh(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 5, b0: 1, b1: 20, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var configs []*runConfig
+	ids := []string{"bolt", "leveldb"}
+	for _, id := range ids {
+		c := &runConfig{
+			p: 20 * time.Millisecond, input: gen.output, id: id, path: path,
+			results: resultsPath(path+"/out.json", id), scanMode: "rows",
+			faultTimeout: time.Second, writers: 1, readers: 1, fresh: true,
+		}
+		if err = c.validate(); err != nil {
+			t.Fatal(err)
+		}
+		configs = append(configs, c)
+	}
+
+	if err = runTrials(configs, ids, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []int64
+	for _, id := range ids {
+		r, err := ReadResults(path + "/out." + id + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(r.Path, path+"/kvbench-"+id+"-") {
+			t.Errorf("expected a temporary database under %s, got %s", path, r.Path)
+		}
+		if m := r.Metadata; m == nil || m.Options["b"] != id || m.Options["f"] != r.Path || m.Data == nil || m.Data.Path != gen.output {
+			t.Errorf("expected the options and data file in the metadata, got %+v", m)
+		}
+		rows = append(rows, r.Rows)
+	}
+	if rows[0] == 0 || rows[0] != rows[1] {
+		t.Errorf("expected both backends to be written the same rows, got %v", rows)
+	}
+
+	left, err := filepath.Glob(path + "/kvbench-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("expected temporary databases to be removed, found %v", left)
+	}
+}
+
+func TestRunTrialsCount(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 5, b0: 1, b1: 20, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &runConfig{
+		p: 20 * time.Millisecond, input: gen.output, id: "bolt", path: path,
+		results: path + "/out.json", scanMode: "rows",
+		faultTimeout: time.Second, writers: 1, readers: 1,
+	}
+	if err = runTrials([]*runConfig{c}, []string{"bolt"}, 3, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for trial := 1; trial <= 3; trial++ {
+		r, err := ReadResults(fmt.Sprintf("%s/out.%d.json", path, trial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.RowSets != 5 {
+			t.Errorf("trial %d: expected 5 row sets, got %d", trial, r.RowSets)
+		}
+		if contains(paths, r.Path) {
+			t.Errorf("trial %d: expected a fresh database, got %s again", trial, r.Path)
+		}
+		paths = append(paths, r.Path)
+	}
+}
+
+func TestRunTrialsCountServer(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 5, b0: 1, b1: 20, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newRESPServer(t)
+	defer s.Close()
+
+	// the server's address is used as given in every trial
+	c := &runConfig{
+		p: 20 * time.Millisecond, input: gen.output, id: "resp", path: s.Addr(),
+		results: path + "/out.json", scanMode: "rows",
+		faultTimeout: time.Second, writers: 1, readers: 1,
+	}
+	if err = runTrials([]*runConfig{c}, []string{"resp"}, 2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for trial := 1; trial <= 2; trial++ {
+		r, err := ReadResults(fmt.Sprintf("%s/out.%d.json", path, trial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Path != s.Addr() {
+			t.Errorf("trial %d: expected the server at %s, got %s", trial, s.Addr(), r.Path)
+		}
+	}
+}
+
+func TestRunCommandOptions(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 3, b0: 1, b1: 10, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = runCommand([]string{"-i", gen.output, "-b", "bolt", "-f", path, "-d0", "0", "-d1", "0",
+		"-p", "20ms", "-count", "2", "-shuffle", "-fault-timeout", "5s", "-results", path + "/out.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for trial := 1; trial <= 2; trial++ {
+		r, err := ReadResults(fmt.Sprintf("%s/out.%d.json", path, trial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := r.Metadata
+		if m == nil || m.Data == nil {
+			t.Fatalf("trial %d: expected the metadata and data file, got %+v", trial, m)
+		}
+		for k, v := range map[string]string{
+			"count": "2", "shuffle": "true", "fault": "", "fault-fsize": "0",
+			"fault-timeout": "5s", "scenario": "", "d1": "0s", "b": "bolt", "f": r.Path,
+		} {
+			if got, ok := m.Options[k]; !ok || got != v {
+				t.Errorf("trial %d: expected -%s %q in the metadata, got %q", trial, k, v, got)
+			}
+		}
+	}
+}
+
+func TestRunScenarioOverrides(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "scenario.json")
+	err = ioutil.WriteFile(file, []byte(`{
+		"name": "overrides",
+		"data": {"path": "x.dat", "generate": {"blocks": 3}},
+		"backends": [{"id": "map"}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace := filepath.Join(path, "x.trace")
+	err = runCommand([]string{"-scenario", file, "-trace", trace, "-replay", trace})
+	if _, ok := err.(usageError); !ok || !strings.Contains(err.Error(), "name the same file") {
+		t.Errorf("expected -trace and -replay naming one file to be rejected, got %v", err)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	group := func(name string, runs int) *ResultsGroup {
+		g := &ResultsGroup{Name: name}
+		for i := 0; i < runs; i++ {
+			r := &Results{Id: "bolt", Path: "x.db", Scan: "rows", Start: t0, End: t0.Add(time.Minute), RowSets: 10, Rows: 100}
+			for j := 1; j <= 3; j++ {
+				r.add(PollRecord{
+					Time:       t0.Add(time.Duration(j) * time.Second),
+					Rows:       100 * j,
+					Scan:       time.Millisecond,
+					Disk:       &DiskSample{Bytes: int64(1000 * j), Written: 3000, Logical: 1000, Live: 1000},
+					SetLatency: &Latency{Count: 3, P50: time.Millisecond, P90: 2 * time.Millisecond, P99: 3 * time.Millisecond},
+				})
+			}
+			g.Results = append(g.Results, r)
+		}
+		return g
+	}
+
+	buf := &bytes.Buffer{}
+	groups := []*ResultsGroup{group("old <a>", 2), group("new", 1)}
+	if err := WriteReport(buf, "soak & burn", groups); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>soak &amp; burn</title>",
+		"old &lt;a&gt; #2",
+		"Scan throughput (rows/s)",
+		"Set latency p50 and p99",
+		"new p99",
+		"Disk size (bytes)",
+		"Median bytes on disk",
+		"<polyline",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the report", want)
+		}
+	}
+	if !regexp.MustCompile(`runs +2 +1`).MatchString(out) {
+		t.Errorf("expected the comparison table in the report")
+	}
+	if strings.Contains(out, "<script") || strings.Contains(out, "src=") || strings.Contains(out, "href=") {
+		t.Errorf("expected a report without external resources")
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 30, b0: 1, b1: 5, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(seed int64, trace, replay string) (s *Schedule) {
+		c := &runConfig{
+			seed: seed, d0: time.Millisecond, d1: 3 * time.Millisecond, p: 15 * time.Millisecond,
+			input: gen.output, id: "map", scanMode: "rows", writers: 2, readers: 2,
+			faultTimeout: time.Second, trace: trace, replay: replay,
+		}
+		if replay != "" {
+			c.duration = time.Millisecond
+		}
+		if err := c.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.run(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err = ReadSchedule(trace); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	same := func(a, b []time.Duration) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	s1 := run(5, path+"/1.trace", "")
+	s2 := run(5, path+"/2.trace", "")
+	if s1.Sends != 30 || !same(s1.Delays, s2.Delays) {
+		t.Errorf("expected runs with the same seed to send 30 row sets after the same delays, got %v and %v", s1.Delays, s2.Delays)
+	}
+	if s3 := run(6, path+"/3.trace", ""); same(s1.Delays, s3.Delays) {
+		t.Errorf("expected runs with another seed to draw other delays")
+	}
+
+	// the replay ignores its own seed and duration, and may
+	// finish writing before the last of the traced polls
+	s4 := run(6, path+"/4.trace", path+"/1.trace")
+	if s4.Sends != s1.Sends || !same(s1.Delays, s4.Delays) {
+		t.Errorf("expected the replay to repeat %d sends after the same delays, got %d", s1.Sends, s4.Sends)
+	}
+	if len(s4.Polls) > len(s1.Polls) {
+		t.Errorf("expected at most the %d traced polls, got %d", len(s1.Polls), len(s4.Polls))
+	}
+	for i, at := range s4.Polls {
+		if at < s1.Polls[i] {
+			t.Errorf("poll %d: expected it at %s, got %s", i, s1.Polls[i], at)
+		}
+	}
+
+	ops, err := ReadTrace(path + "/1.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := map[string]int{}
+	for _, op := range ops {
+		ran[op.Op]++
+	}
+	if ran["set"] != 30 || ran["end"] != 1 || ran["scan"] != 2*(ran["poll"]+1) {
+		t.Errorf("expected 30 writes and 2 scans a poll, got %v", ran)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	gen := &generateConfig{blocks: 1000, b0: 1, b1: 5, k0: 8, k1: 8, v0: 8, v1: 16, output: path + "/x.dat"}
+	if err = gen.generate(NewRandom(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := notifyInterrupt()
+	defer stop.release()
+	c := &runConfig{
+		d0: 5 * time.Millisecond, d1: 5 * time.Millisecond, p: 20 * time.Millisecond,
+		input: gen.output, id: "bolt", path: path + "/x.db", results: path + "/out.json",
+		scanMode: "rows", writers: 1, readers: 1, stop: stop,
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(os.Interrupt)
+	}()
+
+	t0 := time.Now()
+	if _, err = c.run(); err != errInterrupted {
+		t.Fatalf("expected the run to be interrupted, got %v", err)
+	}
+	if d := time.Since(t0); d > 2*time.Second {
+		t.Errorf("expected the run to stop soon after the signal, took %s", d)
+	}
+
+	r, err := ReadResults(c.results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Interrupted || r.RowSets == 0 || r.RowSets >= 1000 || len(r.Polls) == 0 {
+		t.Errorf("expected the results of part of the data file, got %s", r.Summary())
+	}
+
+	// the collection was closed, so it can be opened again
+	b, err := NewBenchmark("bolt", c.path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close(false)
+}
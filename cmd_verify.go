@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+var verifyUsage = `USAGE:
+
+kvbench verify -i dat -b bench -f path
+
+Check that the -b benchmark's database at -f path holds exactly the
+rows of the data file -i, as left by a completed kvbench run: every
+key in the file with the value of its last occurrence, and no other
+keys.  The exit status is 1 if any row is missing, differs or is not
+in the file.
+
+OPTIONS
+
+-i dat   - input path for data file
+-b bench - name of the benchmark whose database to check; the
+           in-memory collections and noop keep nothing to verify
+-f path  - path to the database, or host:port for resp and remote
+
+-sqlite-journal mode - sqlite journal_mode
+-sqlite-sync level   - sqlite synchronous level
+`
+
+// VerifyReport describes how the contents of a database
+// differ from the rows of a data file.
+type VerifyReport struct {
+	Expected   int // distinct keys in the data file
+	Found      int // keys in the database
+	Missing    int // keys in the file but not the database
+	Mismatched int // keys whose value differs from the file
+	Unexpected int // keys in the database but not the file
+}
+
+// Ok reports whether the database matched the file.
+func (r *VerifyReport) Ok() bool {
+	return r.Missing == 0 && r.Mismatched == 0 && r.Unexpected == 0
+}
+
+func (r *VerifyReport) String() string {
+	return fmt.Sprintf("%d rows expected, %d found: %d missing, %d mismatched, %d unexpected",
+		r.Expected, r.Found, r.Missing, r.Mismatched, r.Unexpected)
+}
+
+// Verify compares the contents of c against the last
+// value written for each key by the data file in r.
+func Verify(ctx context.Context, c Collection, r io.Reader) (report *VerifyReport, err error) {
+	expected := make(map[string][]byte)
+	br := bufio.NewReader(r)
+	for {
+		var rows []*Row
+		rows, err = ReadRows(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		for _, row := range rows {
+			expected[string(row.Key.b)] = row.Value.b
+		}
+	}
+
+	report = &VerifyReport{Expected: len(expected)}
+	seen := make(map[string]bool, len(expected))
+	err = c.ForEach(ctx, func(k, v []byte) error {
+		report.Found++
+		want, ok := expected[string(k)]
+		switch {
+		case !ok:
+			report.Unexpected++
+		case !bytes.Equal(v, want):
+			report.Mismatched++
+		}
+		if ok {
+			seen[string(k)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Missing = len(expected) - len(seen)
+	return report, nil
+}
+
+func verifyCommand(args []string) (err error) {
+	var input, id, path string
+	var opts CollectionOptions
+
+	fs := newFlagSet("verify", verifyUsage)
+	fs.StringVar(&input, "i", "", "input path for data")
+	fs.StringVar(&id, "b", "", "benchmark id: "+strings.Join(collectionIds, ", "))
+	fs.StringVar(&path, "f", "", "database path, or host:port for resp and remote")
+	sqliteFlags(fs, &opts.SQLite)
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	switch {
+	case input == "":
+		return usageError{fmt.Errorf("missing required -i <dat> argument")}
+	case id == "":
+		return usageError{fmt.Errorf("missing required -b <benchmarkId> argument")}
+	case !contains(collectionIds, id):
+		return usageError{fmt.Errorf("unknown benchmark id: %s", id)}
+	case contains(memoryIds, id):
+		return usageError{fmt.Errorf("%s keeps no data to verify", id)}
+	case path == "":
+		return usageError{fmt.Errorf("missing required -f <database> argument")}
+	}
+
+	fh, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	if err = checkDatabase(id, path); err != nil {
+		return
+	}
+	c, err := openCollection(id, path, false, &opts)
+	if err != nil {
+		return
+	}
+	defer c.Close(true)
+
+	log.Printf("verifying %s at %s against %s\n", id, path, input)
+	report, err := Verify(context.Background(), c, fh)
+	if err != nil {
+		return
+	}
+
+	log.Printf("%s: %s\n", id, report)
+	if !report.Ok() {
+		return fmt.Errorf("%s: database at %s does not match %s", id, path, input)
+	}
+	return nil
+}
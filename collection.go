@@ -1,13 +1,255 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 )
 
+// Collection is a sorted key/value store under test.
+// ForEach calls fn with each key and value in key order,
+// stopping at the first error fn returns; k and v are
+// only valid for the duration of the call.  Rows sends
+// each row in key order on a channel it closes at the end.
+// Timing iterates over Rows, returning the number of rows,
+// the sum of their Size, and the time it took.
+//
+// Once ctx is done every method but Close stops early,
+// returning ctx.Err(), and Rows closes its channel, so
+// that a scan whose consumer stops reading does not hold a
+// read transaction or lock.  Writes already applied are
+// not undone.
 type Collection interface {
 	Close(force bool) (err error)
-	Delete(k RowKey) (err error)
-	Rows() (ch chan Row)
-	Set(rows []*Row) (err error)
-	Timing() (int, time.Duration)
+	Delete(ctx context.Context, k RowKey) (err error)
+	ForEach(ctx context.Context, fn func(k, v []byte) error) (err error)
+	Rows(ctx context.Context) (ch chan Row)
+	Set(ctx context.Context, rows []*Row) (err error)
+	Timing(ctx context.Context) (int, int64, time.Duration)
+}
+
+// GetCollection is implemented by collections that can
+// look up a single key without a scan.  found is false if
+// k is not stored, and v remains valid after Get returns.
+type GetCollection interface {
+	Get(ctx context.Context, k []byte) (v []byte, found bool, err error)
+}
+
+// getValue looks up k in c, walking c up to k if it is
+// not a GetCollection.
+func getValue(ctx context.Context, c Collection, k []byte) (v []byte, found bool, err error) {
+	if gc, ok := c.(GetCollection); ok {
+		return gc.Get(ctx, k)
+	}
+
+	stop := errors.New("found")
+	err = c.ForEach(ctx, func(bk, bv []byte) error {
+		switch bytes.Compare(bk, k) {
+		case 0:
+			v, found = append([]byte(nil), bv...), true
+			return stop
+		case 1:
+			return stop
+		}
+		return nil
+	})
+	if err == stop {
+		err = nil
+	}
+	return
+}
+
+// collectionIds lists the benchmark ids accepted by
+// openCollection.
+var collectionIds = []string{
+	"badger", "bbolt", "bolt", "btree", "kv", "kv-mu", "leveldb",
+	"map", "noop", "pebble", "remote", "resp", "skiplist", "sqlite",
+}
+
+// memoryIds lists the benchmark ids of collections that
+// keep nothing on disk and so need no database path.
+var memoryIds = []string{"btree", "map", "noop", "skiplist"}
+
+// serverIds lists the benchmark ids of collections served
+// by another process at host:port, which keep nothing
+// under a local path.
+var serverIds = []string{"remote", "resp"}
+
+// CollectionOptions holds the options of the backends that
+// take any.  Options that are not set, or a nil
+// *CollectionOptions, take the backend's defaults.
+type CollectionOptions struct {
+	SQLite SQLiteOptions
+}
+
+// openCollection opens the Collection identified by id at
+// path with opts.  If create is false an existing kv
+// database is opened instead of a new one being created.
+func openCollection(id string, path string, create bool, opts *CollectionOptions) (c Collection, err error) {
+	if opts == nil {
+		opts = &CollectionOptions{}
+	}
+
+	switch id {
+	case "badger":
+		c, err = NewBadgerCollection(path)
+	case "bbolt":
+		c, err = NewBBoltCollection(path)
+	case "bolt":
+		c, err = NewBoltCollection(path)
+	case "btree":
+		c, err = NewBTreeCollection()
+	case "kv", "kv-mu":
+		if create {
+			c, err = NewKVCollection(path)
+		} else {
+			c, err = OpenKVCollection(path)
+		}
+	case "leveldb":
+		c, err = NewLevelDBCollection(path)
+	case "map":
+		c, err = NewMapCollection()
+	case "noop":
+		c, err = NewNoopCollection()
+	case "pebble":
+		c, err = NewPebbleCollection(path)
+	case "remote":
+		c, err = NewRemoteCollection(path)
+	case "resp":
+		c, err = NewRESPCollection(path)
+	case "skiplist":
+		c, err = NewSkiplistCollection()
+	case "sqlite":
+		c, err = NewSQLiteCollection(path, &opts.SQLite)
+	default:
+		err = fmt.Errorf("unknown benchmark id: %s", id)
+	}
+	return
+}
+
+// checkDatabase returns an error if the collection
+// identified by id keeps its database on disk and there is
+// none at path, as opening it would create an empty one.
+func checkDatabase(id string, path string) error {
+	if contains(serverIds, id) || contains(memoryIds, id) {
+		return nil
+	}
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no %s database at %s", id, path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	return nil
+}
+
+// forEachRows returns a channel of the rows in c, decoded
+// from the keys and values visited by c.ForEach.
+func forEachRows(ctx context.Context, c Collection) (ch chan Row) {
+	ch = make(chan Row, 1000)
+
+	go func(ch chan Row) {
+		defer close(ch)
+
+		err := c.ForEach(ctx, func(k, v []byte) error {
+			row := Row{}
+
+			row.Key, row.Err = DecodeRowKey(k)
+			if row.Err == nil {
+				row.Value, row.Err = DecodeRowValue(v)
+			}
+			if !sendRow(ctx, ch, row) {
+				return ctx.Err()
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			ch <- Row{Err: err}
+		}
+	}(ch)
+
+	return ch
+}
+
+// errClosed is returned by scans that begin once their
+// collection is closing.
+var errClosed = errors.New("collection is closed")
+
+// scanGroup counts the scans open on a collection so that
+// Close(false) can wait for them to end.  Once stopScans
+// is called no scan may begin, so that the count is never
+// raised while it is waited on.
+type scanGroup struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// beginScan records the start of a scan, which must call
+// endScan when it ends, or returns errClosed.
+func (g *scanGroup) beginScan() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return errClosed
+	}
+	g.wg.Add(1)
+	return nil
+}
+
+func (g *scanGroup) endScan() {
+	g.wg.Done()
+}
+
+// stopScans stops new scans from beginning and, unless
+// force is true, waits for the open ones to end.
+func (g *scanGroup) stopScans(force bool) {
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+
+	if !force {
+		g.wg.Wait()
+	}
+}
+
+// closedRows sends err on ch and closes it, for a Rows
+// that cannot begin its scan.
+func closedRows(ch chan Row, err error) chan Row {
+	ch <- Row{Err: err}
+	close(ch)
+	return ch
+}
+
+// sendRow sends row on ch, or returns false without
+// sending once ctx is done.
+func sendRow(ctx context.Context, ch chan Row, row Row) bool {
+	select {
+	case ch <- row:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// withContext wraps fn, the function passed to ForEach, so
+// that the iteration stops with ctx.Err() once ctx is done.
+func withContext(ctx context.Context, fn func(k, v []byte) error) func(k, v []byte) error {
+	done := ctx.Done()
+	if done == nil {
+		return fn
+	}
+	return func(k, v []byte) error {
+		select {
+		case <-done:
+			return ctx.Err()
+		default:
+		}
+		return fn(k, v)
+	}
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	badger "github.com/dgraph-io/badger/v4"
+	"time"
+)
+
+// BadgerCollection stores rows in Badger, an LSM tree
+// that keeps values in a separate value log.
+type BadgerCollection struct {
+	scanGroup
+	db *badger.DB
+}
+
+func NewBadgerCollection(path string) (c Collection, err error) {
+	bdb := &BadgerCollection{}
+
+	opts := badger.DefaultOptions(path).WithLogger(nil)
+
+	bdb.db, err = badger.Open(opts)
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	return bdb, err
+}
+
+func (c *BadgerCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	err = c.db.Close()
+	return
+}
+
+func (c *BadgerCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *BadgerCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	return c.db.View(
+		func(txn *badger.Txn) error {
+			iter := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
+
+			fn := withContext(ctx, fn)
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				item := iter.Item()
+				k := item.Key()
+				err := item.Value(func(v []byte) error {
+					return fn(k, v)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
+func (c *BadgerCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	return c.db.Update(
+		func(txn *badger.Txn) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				var bk, bv []byte
+
+				bk, err = row.Key.Bytes()
+				if err != nil {
+					return err
+				}
+
+				bv, err = row.Value.Bytes()
+				if err != nil {
+					return err
+				}
+
+				err = txn.Set(bk, bv)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+}
+
+func (c *BadgerCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.db.Update(
+		func(txn *badger.Txn) error {
+			var bk []byte
+			bk, err = k.Bytes()
+			if err != nil {
+				return err
+			}
+
+			return txn.Delete(bk)
+		})
+}
+
+func (c *BadgerCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = c.db.View(
+		func(txn *badger.Txn) error {
+			item, err := txn.Get(k)
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			v, err = item.ValueCopy(nil)
+			found = err == nil
+			return err
+		})
+	return
+}
+
+func (c *BadgerCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *BadgerCollection) Stats() map[string]interface{} {
+	lsm, vlog := c.db.Size()
+	m := map[string]interface{}{
+		"lsm_size":  lsm,
+		"vlog_size": vlog,
+	}
+
+	tables := c.db.Tables()
+	m["tables"] = len(tables)
+	for _, t := range tables {
+		k := fmt.Sprintf("level%d.tables", t.Level)
+		n, _ := m[k].(int)
+		m[k] = n + 1
+	}
+
+	return m
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// BBoltCollection stores rows in bbolt, the maintained
+// fork of bolt.
+type BBoltCollection struct {
+	scanGroup
+	db *bbolt.DB
+}
+
+func NewBBoltCollection(path string) (c Collection, err error) {
+	bboltc := &BBoltCollection{}
+
+	bboltc.db, err = bbolt.Open(path, 0644, nil)
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+	err = bboltc.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketId)
+		return err
+	})
+	return bboltc, err
+}
+
+func (c *BBoltCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	err = c.db.Close()
+	return
+}
+
+func (c *BBoltCollection) Rows(ctx context.Context) (ch chan Row) {
+	ch = make(chan Row, 1000)
+	if err := c.beginScan(); err != nil {
+		return closedRows(ch, err)
+	}
+
+	go func(ch chan Row) {
+		defer c.endScan()
+		defer close(ch)
+
+		c.db.View(
+			func(tx *bbolt.Tx) error {
+
+				cursor := tx.Bucket(bucketId).Cursor()
+
+				for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+					row := Row{}
+
+					row.Key, row.Err = DecodeRowKey(k)
+					if row.Err == nil {
+						row.Value, row.Err = DecodeRowValue(v)
+					}
+
+					// return, ending the read transaction,
+					// if the consumer has gone away
+					if !sendRow(ctx, ch, row) {
+						return ctx.Err()
+					}
+				}
+
+				return nil
+			})
+
+	}(ch)
+
+	return ch
+}
+
+func (c *BBoltCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	return c.db.View(
+		func(tx *bbolt.Tx) error {
+			return tx.Bucket(bucketId).ForEach(withContext(ctx, fn))
+		})
+}
+
+func (c *BBoltCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	return c.db.Update(
+		func(tx *bbolt.Tx) error {
+			// the context may have ended while
+			// waiting for the writer lock
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			b := tx.Bucket(bucketId)
+
+			for _, row := range rows {
+				var bk, bv []byte
+
+				bk, err = row.Key.Bytes()
+				if err != nil {
+					return err
+				}
+
+				bv, err = row.Value.Bytes()
+				if err != nil {
+					return err
+				}
+
+				err = b.Put(bk, bv)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+}
+
+func (c *BBoltCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(bucketId)
+
+			var bk []byte
+			bk, err = k.Bytes()
+			if err != nil {
+				return err
+			}
+
+			return b.Delete(bk)
+		})
+}
+
+func (c *BBoltCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = c.db.View(
+		func(tx *bbolt.Tx) error {
+			if bv := tx.Bucket(bucketId).Get(k); bv != nil {
+				v, found = append([]byte(nil), bv...), true
+			}
+			return nil
+		})
+	return
+}
+
+func (c *BBoltCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *BBoltCollection) Stats() map[string]interface{} {
+	s := c.db.Stats()
+	return map[string]interface{}{
+		"free_pages":        s.FreePageN,
+		"pending_pages":     s.PendingPageN,
+		"free_alloc":        s.FreeAlloc,
+		"freelist_inuse":    s.FreelistInuse,
+		"tx":                s.TxN,
+		"open_tx":           s.OpenTxN,
+		"tx.page_count":     s.TxStats.GetPageCount(),
+		"tx.page_alloc":     s.TxStats.GetPageAlloc(),
+		"tx.cursor_count":   s.TxStats.GetCursorCount(),
+		"tx.node_count":     s.TxStats.GetNodeCount(),
+		"tx.node_deref":     s.TxStats.GetNodeDeref(),
+		"tx.rebalance":      s.TxStats.GetRebalance(),
+		"tx.rebalance_time": s.TxStats.GetRebalanceTime(),
+		"tx.split":          s.TxStats.GetSplit(),
+		"tx.spill":          s.TxStats.GetSpill(),
+		"tx.spill_time":     s.TxStats.GetSpillTime(),
+		"tx.write":          s.TxStats.GetWrite(),
+		"tx.write_time":     s.TxStats.GetWriteTime(),
+	}
+}
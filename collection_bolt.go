@@ -1,16 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/boltdb/bolt"
-	"sync"
 	"time"
 )
 
 var bucketId = []byte("values")
 
 type BoltCollection struct {
-	sync.WaitGroup
+	scanGroup
 	db *bolt.DB
 }
 
@@ -30,17 +30,19 @@ func NewBoltCollection(path string) (c Collection, err error) {
 }
 
 func (c *BoltCollection) Close(force bool) (err error) {
-	if !force {
-		c.Wait()
-	}
+	c.stopScans(force)
 	err = c.db.Close()
 	return
 }
 
-func (c *BoltCollection) Rows() (ch chan Row) {
+func (c *BoltCollection) Rows(ctx context.Context) (ch chan Row) {
 	ch = make(chan Row, 1000)
+	if err := c.beginScan(); err != nil {
+		return closedRows(ch, err)
+	}
 
 	go func(ch chan Row) {
+		defer c.endScan()
 		defer close(ch)
 
 		c.db.View(
@@ -52,18 +54,15 @@ func (c *BoltCollection) Rows() (ch chan Row) {
 					row := Row{}
 
 					row.Key, row.Err = DecodeRowKey(k)
-					if row.Err != nil {
-						ch <- row
-						continue
+					if row.Err == nil {
+						row.Value, row.Err = DecodeRowValue(v)
 					}
 
-					row.Value, row.Err = DecodeRowValue(v)
-					if row.Err != nil {
-						ch <- row
-						continue
+					// return, ending the read transaction,
+					// if the consumer has gone away
+					if !sendRow(ctx, ch, row) {
+						return ctx.Err()
 					}
-
-					ch <- row
 				}
 
 				return nil
@@ -74,9 +73,27 @@ func (c *BoltCollection) Rows() (ch chan Row) {
 	return ch
 }
 
-func (c *BoltCollection) Set(rows []*Row) (err error) {
+func (c *BoltCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	return c.db.View(
+		func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketId).ForEach(withContext(ctx, fn))
+		})
+}
+
+func (c *BoltCollection) Set(ctx context.Context, rows []*Row) (err error) {
 	return c.db.Update(
 		func(tx *bolt.Tx) error {
+			// the context may have ended while
+			// waiting for the writer lock
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			b := tx.Bucket(bucketId)
 
 			for _, row := range rows {
@@ -102,7 +119,10 @@ func (c *BoltCollection) Set(rows []*Row) (err error) {
 		})
 }
 
-func (c *BoltCollection) Delete(k RowKey) (err error) {
+func (c *BoltCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	return c.db.Update(
 		func(tx *bolt.Tx) error {
 			b := tx.Bucket(bucketId)
@@ -117,12 +137,51 @@ func (c *BoltCollection) Delete(k RowKey) (err error) {
 		})
 }
 
-func (c *BoltCollection) Timing() (int, time.Duration) {
+func (c *BoltCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = c.db.View(
+		func(tx *bolt.Tx) error {
+			if bv := tx.Bucket(bucketId).Get(k); bv != nil {
+				v, found = append([]byte(nil), bv...), true
+			}
+			return nil
+		})
+	return
+}
+
+func (c *BoltCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
 	t0 := time.Now()
-	n := 0
-	for range c.Rows() {
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
 		n++
+		size += row.Size()
 	}
 	t1 := time.Now()
-	return n, t1.Sub(t0)
+	return n, size, t1.Sub(t0)
+}
+
+func (c *BoltCollection) Stats() map[string]interface{} {
+	s := c.db.Stats()
+	return map[string]interface{}{
+		"free_pages":        s.FreePageN,
+		"pending_pages":     s.PendingPageN,
+		"free_alloc":        s.FreeAlloc,
+		"freelist_inuse":    s.FreelistInuse,
+		"tx":                s.TxN,
+		"open_tx":           s.OpenTxN,
+		"tx.page_count":     s.TxStats.PageCount,
+		"tx.page_alloc":     s.TxStats.PageAlloc,
+		"tx.cursor_count":   s.TxStats.CursorCount,
+		"tx.node_count":     s.TxStats.NodeCount,
+		"tx.node_deref":     s.TxStats.NodeDeref,
+		"tx.rebalance":      s.TxStats.Rebalance,
+		"tx.rebalance_time": s.TxStats.RebalanceTime,
+		"tx.split":          s.TxStats.Split,
+		"tx.spill":          s.TxStats.Spill,
+		"tx.spill_time":     s.TxStats.SpillTime,
+		"tx.write":          s.TxStats.Write,
+		"tx.write_time":     s.TxStats.WriteTime,
+	}
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/google/btree"
+	"sync"
+	"time"
+)
+
+// btreeDegree is the degree of the B-tree used by
+// BTreeCollection, the same default google/btree's
+// own benchmarks use.
+const btreeDegree = 32
+
+// btreeItem is a key and value stored in the B-tree,
+// ordered by key.
+type btreeItem struct {
+	k, v []byte
+}
+
+func (a *btreeItem) Less(b btree.Item) bool {
+	return bytes.Compare(a.k, b.(*btreeItem).k) < 0
+}
+
+// BTreeCollection keeps rows in an in-memory B-tree.
+type BTreeCollection struct {
+	sync.RWMutex
+	scanGroup
+	t *btree.BTree
+}
+
+func NewBTreeCollection() (c Collection, err error) {
+	return &BTreeCollection{t: btree.New(btreeDegree)}, nil
+}
+
+func (c *BTreeCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	return nil
+}
+
+func (c *BTreeCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *BTreeCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	c.RLock()
+	defer c.RUnlock()
+
+	fn = withContext(ctx, fn)
+	c.t.Ascend(func(i btree.Item) bool {
+		item := i.(*btreeItem)
+		err = fn(item.k, item.v)
+		return err == nil
+	})
+	return
+}
+
+func (c *BTreeCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, row := range rows {
+		item := &btreeItem{}
+
+		item.k, err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		item.v, err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+
+		c.t.ReplaceOrInsert(item)
+	}
+	return
+}
+
+func (c *BTreeCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	c.Lock()
+	c.t.Delete(&btreeItem{k: bk})
+	c.Unlock()
+	return
+}
+
+func (c *BTreeCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.RLock()
+	item := c.t.Get(&btreeItem{k: k})
+	c.RUnlock()
+	if item == nil {
+		return
+	}
+	return item.(*btreeItem).v, true, nil
+}
+
+func (c *BTreeCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *BTreeCollection) Stats() map[string]interface{} {
+	c.RLock()
+	defer c.RUnlock()
+	return map[string]interface{}{"rows": c.t.Len()}
+}
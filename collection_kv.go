@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/cznic/kv"
 	"io"
@@ -9,17 +10,34 @@ import (
 )
 
 type KVCollection struct {
-	sync.WaitGroup
+	scanGroup
 	db *kv.DB
 	mu sync.Mutex
 }
 
+// kvOptions returns the options a kv database at path is
+// created and opened with.  The write ahead log is named
+// after path so that NewFaultKVCollection can create it.
+func kvOptions(path string) *kv.Options {
+	return &kv.Options{WAL: path + ".wal"}
+}
+
 func NewKVCollection(path string) (c Collection, err error) {
 	kvdb := &KVCollection{}
 
-	opts := &kv.Options{}
+	kvdb.db, err = kv.Create(path, kvOptions(path))
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
 
-	kvdb.db, err = kv.Create(path, opts)
+	return kvdb, err
+}
+
+func OpenKVCollection(path string) (c Collection, err error) {
+	kvdb := &KVCollection{}
+
+	kvdb.db, err = kv.Open(path, kvOptions(path))
 	if err != nil {
 		err = fmt.Errorf("unable to open %s: %v", path, err)
 		return
@@ -29,17 +47,20 @@ func NewKVCollection(path string) (c Collection, err error) {
 }
 
 func (c *KVCollection) Close(force bool) (err error) {
-	if !force {
-		c.Wait()
-	}
+	c.stopScans(force)
 	err = c.db.Close()
 	return
 }
 
-func (c *KVCollection) Rows() (ch chan Row) {
+func (c *KVCollection) Rows(ctx context.Context) (ch chan Row) {
 	ch = make(chan Row, 1000)
+	if err := c.beginScan(); err != nil {
+		return closedRows(ch, err)
+	}
 
 	go func(ch chan Row) {
+		defer c.endScan()
+
 		c.mu.Lock()
 		defer c.mu.Unlock()
 		defer close(ch)
@@ -47,7 +68,7 @@ func (c *KVCollection) Rows() (ch chan Row) {
 		enum, err := c.db.SeekFirst()
 		if err != nil {
 			if err != io.EOF {
-				ch <- Row{Err: err}
+				sendRow(ctx, ch, Row{Err: err})
 			}
 			return
 		}
@@ -56,7 +77,7 @@ func (c *KVCollection) Rows() (ch chan Row) {
 			kb, vb, err := enum.Next()
 			if err != nil {
 				if err != io.EOF {
-					ch <- Row{Err: err}
+					sendRow(ctx, ch, Row{Err: err})
 				}
 				return
 			}
@@ -64,30 +85,76 @@ func (c *KVCollection) Rows() (ch chan Row) {
 			row := Row{}
 
 			row.Key, row.Err = DecodeRowKey(kb)
-			if row.Err != nil {
-				ch <- row
-				continue
+			if row.Err == nil {
+				row.Value, row.Err = DecodeRowValue(vb)
 			}
 
-			row.Value, row.Err = DecodeRowValue(vb)
-			if row.Err != nil {
-				ch <- row
-				continue
+			// return, releasing c.mu, if the
+			// consumer has gone away
+			if !sendRow(ctx, ch, row) {
+				return
 			}
-
-			ch <- row
 		}
 	}(ch)
 
 	return ch
 }
 
-func (c *KVCollection) Set(rows []*Row) (err error) {
+func (c *KVCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	enum, err := c.db.SeekFirst()
+	if err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+
+	fn = withContext(ctx, fn)
+
+	for {
+		kb, vb, err := enum.Next()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return err
+		}
+
+		if err = fn(kb, vb); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *KVCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	c.mu.Lock()
-	c.db.BeginTransaction()
-	defer c.db.Commit()
 	defer c.mu.Unlock()
 
+	if err = c.db.BeginTransaction(); err != nil {
+		return
+	}
+	// commit, or roll back a failed Set, before the
+	// lock is released
+	defer func() {
+		if err != nil {
+			c.db.Rollback()
+			return
+		}
+		err = c.db.Commit()
+	}()
+
 	for _, row := range rows {
 
 		var bk, bv []byte
@@ -110,7 +177,11 @@ func (c *KVCollection) Set(rows []*Row) (err error) {
 	return
 }
 
-func (c *KVCollection) Delete(k RowKey) (err error) {
+func (c *KVCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var bk []byte
@@ -123,12 +194,34 @@ func (c *KVCollection) Delete(k RowKey) (err error) {
 	return
 }
 
-func (c *KVCollection) Timing() (int, time.Duration) {
+// Get cannot tell a missing key from an empty value, as
+// kv returns nil for both.
+func (c *KVCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, err = c.db.Get(nil, k)
+	return v, v != nil, err
+}
+
+func (c *KVCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
 	t0 := time.Now()
-	n := 0
-	for range c.Rows() {
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
 		n++
+		size += row.Size()
 	}
 	t1 := time.Now()
-	return n, t1.Sub(t0)
+	return n, size, t1.Sub(t0)
+}
+
+func (c *KVCollection) Stats() map[string]interface{} {
+	m := make(map[string]interface{})
+	if n, err := c.db.Size(); err == nil {
+		m["file_size"] = n
+	}
+	return m
 }
@@ -1,16 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/syndtr/goleveldb/leveldb"
 	"io/ioutil"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 )
 
 type LevelDBCollection struct {
-	sync.WaitGroup
+	scanGroup
 	db        *leveldb.DB
 	cleanupFn func()
 }
@@ -39,9 +40,7 @@ func NewLevelDBCollection(path string) (c Collection, err error) {
 }
 
 func (c *LevelDBCollection) Close(force bool) (err error) {
-	if !force {
-		c.Wait()
-	}
+	c.stopScans(force)
 	err = c.db.Close()
 	if c.cleanupFn != nil {
 		c.cleanupFn()
@@ -49,36 +48,57 @@ func (c *LevelDBCollection) Close(force bool) (err error) {
 	return
 }
 
-func (c *LevelDBCollection) Rows() (ch chan Row) {
+func (c *LevelDBCollection) Rows(ctx context.Context) (ch chan Row) {
 	ch = make(chan Row, 1000)
+	if err := c.beginScan(); err != nil {
+		return closedRows(ch, err)
+	}
 
 	go func(ch chan Row) {
+		defer c.endScan()
 		defer close(ch)
 
 		iter := c.db.NewIterator(nil, nil)
+		defer iter.Release()
+
 		for iter.Next() {
 			row := Row{}
 
 			row.Key, row.Err = DecodeRowKey(iter.Key())
-			if row.Err != nil {
-				ch <- row
-				continue
+			if row.Err == nil {
+				row.Value, row.Err = DecodeRowValue(iter.Value())
 			}
 
-			row.Value, row.Err = DecodeRowValue(iter.Value())
-			if row.Err != nil {
-				ch <- row
-				continue
+			// return, releasing the iterator's
+			// snapshot, if the consumer has gone away
+			if !sendRow(ctx, ch, row) {
+				return
 			}
-
-			ch <- row
 		}
 	}(ch)
 
 	return ch
 }
 
-func (c *LevelDBCollection) Set(rows []*Row) (err error) {
+func (c *LevelDBCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	iter := c.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	fn = withContext(ctx, fn)
+	for iter.Next() {
+		if err = fn(iter.Key(), iter.Value()); err != nil {
+			return
+		}
+	}
+	return iter.Error()
+}
+
+func (c *LevelDBCollection) Set(ctx context.Context, rows []*Row) (err error) {
 	batch := &leveldb.Batch{}
 	for _, row := range rows {
 		var bk, bv []byte
@@ -95,27 +115,84 @@ func (c *LevelDBCollection) Set(rows []*Row) (err error) {
 
 		batch.Put(bk, bv)
 	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	err = c.db.Write(batch, nil)
 	return
 }
 
-func (c *LevelDBCollection) Delete(k RowKey) (err error) {
+func (c *LevelDBCollection) Delete(ctx context.Context, k RowKey) (err error) {
 	var bk []byte
 	bk, err = k.Bytes()
 	if err != nil {
 		return
 	}
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	err = c.db.Delete(bk, nil)
 	return
 }
 
-func (c *LevelDBCollection) Timing() (int, time.Duration) {
+func (c *LevelDBCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, err = c.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
+	return v, err == nil, err
+}
+
+func (c *LevelDBCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
 	t0 := time.Now()
-	n := 0
-	for range c.Rows() {
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
 		n++
+		size += row.Size()
 	}
 	t1 := time.Now()
-	return n, t1.Sub(t0)
+	return n, size, t1.Sub(t0)
+}
+
+func (c *LevelDBCollection) Stats() map[string]interface{} {
+	m := make(map[string]interface{})
+
+	if v, err := c.db.GetProperty("leveldb.stats"); err == nil {
+		parseLevelDBStats(v, m)
+	}
+
+	if v, err := c.db.GetProperty("leveldb.iostats"); err == nil {
+		var r, w float64
+		if _, err := fmt.Sscanf(v, "Read(MB):%f Write(MB):%f", &r, &w); err == nil {
+			m["io.read_mb"] = r
+			m["io.write_mb"] = w
+		}
+	}
+
+	if v, err := c.db.GetProperty("leveldb.writedelay"); err == nil {
+		var n int
+		var d string
+		var paused bool
+		if _, err := fmt.Sscanf(v, "DelayN:%d Delay:%s Paused:%t", &n, &d, &paused); err == nil {
+			m["writedelay.count"] = n
+			if dur, err := time.ParseDuration(d); err == nil {
+				m["writedelay.duration"] = dur
+			}
+			m["writedelay.paused"] = paused
+		}
+	}
+
+	for _, p := range []string{"openedtables", "cachedblock", "alivesnaps", "aliveiters"} {
+		if v, err := c.db.GetProperty("leveldb." + p); err == nil {
+			if n, err := strconv.Atoi(v); err == nil {
+				m[p] = n
+			}
+		}
+	}
+
+	return m
 }
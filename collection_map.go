@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MapCollection keeps rows in a Go map and sorts the
+// keys each time the collection is iterated over.
+type MapCollection struct {
+	sync.RWMutex
+	scanGroup
+	m map[string][]byte
+}
+
+func NewMapCollection() (c Collection, err error) {
+	return &MapCollection{m: make(map[string][]byte)}, nil
+}
+
+func (c *MapCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	return nil
+}
+
+func (c *MapCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *MapCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]string, 0, len(c.m))
+	for k := range c.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fn = withContext(ctx, fn)
+	for _, k := range keys {
+		if err = fn([]byte(k), c.m[k]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *MapCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, row := range rows {
+		var bk, bv []byte
+
+		bk, err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		bv, err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+
+		c.m[string(bk)] = bv
+	}
+	return
+}
+
+func (c *MapCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	c.Lock()
+	delete(c.m, string(bk))
+	c.Unlock()
+	return
+}
+
+func (c *MapCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.RLock()
+	v, found = c.m[string(k)]
+	c.RUnlock()
+	return
+}
+
+func (c *MapCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *MapCollection) Stats() map[string]interface{} {
+	c.RLock()
+	defer c.RUnlock()
+	return map[string]interface{}{"rows": len(c.m)}
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
 type NoopCollection struct {
 	sync.RWMutex
-	sync.WaitGroup
+	scanGroup
 	n int
 }
 
@@ -16,13 +17,18 @@ func NewNoopCollection() (c Collection, err error) {
 }
 
 func (c *NoopCollection) Close(force bool) (err error) {
+	c.stopScans(force)
 	return nil
 }
 
-func (c *NoopCollection) Rows() (ch chan Row) {
+func (c *NoopCollection) Rows(ctx context.Context) (ch chan Row) {
 	ch = make(chan Row, 1000)
+	if err := c.beginScan(); err != nil {
+		return closedRows(ch, err)
+	}
 
 	go func(ch chan Row) {
+		defer c.endScan()
 		defer close(ch)
 
 		c.RLock()
@@ -31,21 +37,50 @@ func (c *NoopCollection) Rows() (ch chan Row) {
 
 		row := Row{Key: RowKey{}, Value: &RowValue{}}
 		for i := 0; i < n; i++ {
-			ch <- row
+			if !sendRow(ctx, ch, row) {
+				return
+			}
 		}
 	}(ch)
 
 	return ch
 }
 
-func (c *NoopCollection) Set(rows []*Row) (err error) {
+func (c *NoopCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	c.RLock()
+	n := c.n
+	c.RUnlock()
+
+	fn = withContext(ctx, fn)
+	for i := 0; i < n; i++ {
+		if err = fn(nil, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *NoopCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	c.Lock()
 	c.n += len(rows)
 	c.Unlock()
 	return nil
 }
 
-func (c *NoopCollection) Delete(k RowKey) (err error) {
+func (c *NoopCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	c.Lock()
 	if c.n > 0 {
 		c.n = c.n - 1
@@ -54,12 +89,19 @@ func (c *NoopCollection) Delete(k RowKey) (err error) {
 	return nil
 }
 
-func (c *NoopCollection) Timing() (int, time.Duration) {
+func (c *NoopCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
 	t0 := time.Now()
-	n := 0
-	for range c.Rows() {
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
 		n++
+		size += row.Size()
 	}
 	t1 := time.Now()
-	return n, t1.Sub(t0)
+	return n, size, t1.Sub(t0)
+}
+
+func (c *NoopCollection) Stats() map[string]interface{} {
+	c.RLock()
+	defer c.RUnlock()
+	return map[string]interface{}{"rows": c.n}
 }
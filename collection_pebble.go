@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/cockroachdb/pebble"
+	"time"
+)
+
+// PebbleCollection stores rows in Pebble, the LSM tree
+// used by CockroachDB.
+type PebbleCollection struct {
+	scanGroup
+	db *pebble.DB
+}
+
+func NewPebbleCollection(path string) (c Collection, err error) {
+	pdb := &PebbleCollection{}
+
+	pdb.db, err = pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	return pdb, err
+}
+
+func (c *PebbleCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	err = c.db.Close()
+	return
+}
+
+func (c *PebbleCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *PebbleCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	iter, err := c.db.NewIter(nil)
+	if err != nil {
+		return
+	}
+
+	fn = withContext(ctx, fn)
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err = fn(iter.Key(), iter.Value()); err != nil {
+			iter.Close()
+			return
+		}
+	}
+	return iter.Close()
+}
+
+func (c *PebbleCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	batch := c.db.NewBatch()
+	defer batch.Close()
+
+	for _, row := range rows {
+		var bk, bv []byte
+
+		bk, err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		bv, err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+
+		err = batch.Set(bk, bv, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	// match leveldb, which does not sync by default
+	err = batch.Commit(pebble.NoSync)
+	return
+}
+
+func (c *PebbleCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = c.db.Delete(bk, pebble.NoSync)
+	return
+}
+
+func (c *PebbleCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	pv, closer, err := c.db.Get(k)
+	if err == pebble.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return
+	}
+	v = append([]byte(nil), pv...)
+	return v, true, closer.Close()
+}
+
+func (c *PebbleCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *PebbleCollection) Stats() map[string]interface{} {
+	m := c.db.Metrics()
+	s := map[string]interface{}{
+		"compactions":      m.Compact.Count,
+		"compaction_debt":  m.Compact.EstimatedDebt,
+		"flushes":          m.Flush.Count,
+		"read_amp":         m.ReadAmp(),
+		"disk_space_usage": m.DiskSpaceUsage(),
+	}
+	for i, l := range m.Levels {
+		if l.NumFiles == 0 {
+			continue
+		}
+		s[fmt.Sprintf("level%d.tables", i)] = l.NumFiles
+		s[fmt.Sprintf("level%d.size", i)] = l.Size
+	}
+	return s
+}
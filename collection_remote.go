@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+	"time"
+)
+
+// remoteScanPage is the number of rows fetched per
+// ScanNext call.
+const remoteScanPage = 1024
+
+// RemoteCollection is a Collection served by a separate
+// kvbench serve process, so that the store's memory and
+// GC behaviour are measured apart from the load generator.
+type RemoteCollection struct {
+	scanGroup
+	client *rpc.Client
+}
+
+func NewRemoteCollection(addr string) (c Collection, err error) {
+	rc := &RemoteCollection{}
+
+	rc.client, err = rpc.DialHTTP("tcp", addr)
+	if err != nil {
+		err = fmt.Errorf("unable to connect to %s: %v", addr, err)
+		return
+	}
+
+	return rc, nil
+}
+
+func (c *RemoteCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	err = c.client.Close()
+	return
+}
+
+func (c *RemoteCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+// call calls the named method of the server, returning
+// ctx.Err() without waiting for the reply once ctx is done.
+func (c *RemoteCollection) call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	call := c.client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *RemoteCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	var id int64
+	err = c.call(ctx, "Collection.ScanOpen", struct{}{}, &id)
+	if err != nil {
+		return
+	}
+
+	fn = withContext(ctx, fn)
+	for {
+		var reply ScanReply
+		err = c.call(ctx, "Collection.ScanNext", ScanArgs{Id: id, Limit: remoteScanPage}, &reply)
+		if err != nil {
+			// close the scan on the server, which
+			// would otherwise hold its read transaction
+			if ctx.Err() != nil {
+				c.client.Go("Collection.ScanClose", id, &struct{}{}, make(chan *rpc.Call, 1))
+			}
+			return
+		}
+
+		for i := range reply.Keys {
+			if err = fn(reply.Keys[i], reply.Values[i]); err != nil {
+				if !reply.Done {
+					c.client.Call("Collection.ScanClose", id, &struct{}{})
+				}
+				return
+			}
+		}
+
+		if reply.Done {
+			return
+		}
+	}
+}
+
+func (c *RemoteCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	var reply RemoteValue
+	err = c.call(ctx, "Collection.Get", k, &reply)
+	return reply.Value, reply.Found, err
+}
+
+func (c *RemoteCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	args := RemoteRows{
+		Keys:   make([][]byte, len(rows)),
+		Values: make([][]byte, len(rows)),
+	}
+	for i, row := range rows {
+		args.Keys[i], err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		args.Values[i], err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+	}
+	return c.call(ctx, "Collection.Set", args, &struct{}{})
+}
+
+func (c *RemoteCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	return c.call(ctx, "Collection.Delete", bk, &struct{}{})
+}
+
+func (c *RemoteCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *RemoteCollection) Stats() map[string]interface{} {
+	var m map[string]interface{}
+	if err := c.client.Call("Collection.Stats", struct{}{}, &m); err != nil {
+		return nil
+	}
+	return m
+}
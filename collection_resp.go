@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// respKeyPrefix namespaces the keys written by a
+// RESPCollection so that a shared server can be used.
+var respKeyPrefix = []byte("kvbench:")
+
+const (
+	respBatch   = 512              // keys per pipelined MSET, MGET or SCAN COUNT
+	respTimeout = 10 * time.Second // to connect, and for each command
+)
+
+// RESPCollection stores rows on a remote server speaking
+// the Redis protocol.  Redis does not keep keys in order,
+// so ForEach and Rows collect every key with SCAN and sort
+// them before fetching values with MGET.
+type RESPCollection struct {
+	scanGroup
+	addr string
+	mu   sync.Mutex
+	idle []*respConn
+}
+
+func NewRESPCollection(addr string) (c Collection, err error) {
+	rc := &RESPCollection{addr: addr}
+
+	conn, err := rc.get()
+	if err != nil {
+		err = fmt.Errorf("unable to connect to %s: %v", addr, err)
+		return
+	}
+	defer func() { rc.put(conn, err) }()
+
+	reply, err := conn.Do([]byte("PING"))
+	if err == nil {
+		err = respOK(reply)
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to connect to %s: %v", addr, err)
+		return
+	}
+
+	return rc, nil
+}
+
+// get returns an idle connection, or a new one if
+// none are idle.
+func (c *RESPCollection) get() (conn *respConn, err error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn = c.idle[n-1]
+		c.idle = c.idle[:n-1]
+	}
+	c.mu.Unlock()
+
+	if conn != nil {
+		return
+	}
+	return dialRESP(c.addr, respTimeout)
+}
+
+// put returns conn to the idle pool, or closes it if
+// err indicates the connection may be out of sync.
+func (c *RESPCollection) put(conn *respConn, err error) {
+	if _, ok := err.(respError); err != nil && !ok {
+		conn.Close()
+		return
+	}
+	c.mu.Lock()
+	c.idle = append(c.idle, conn)
+	c.mu.Unlock()
+}
+
+func (c *RESPCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.idle {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	c.idle = nil
+	return
+}
+
+func (c *RESPCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *RESPCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	conn, err := c.get()
+	if err != nil {
+		return
+	}
+	release := conn.watch(ctx)
+	defer func() {
+		release()
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.put(conn, err)
+	}()
+
+	keys, err := c.scan(conn)
+	if err != nil {
+		return
+	}
+
+	fn = withContext(ctx, fn)
+
+	for i := 0; i < len(keys); i += respBatch {
+		j := i + respBatch
+		if j > len(keys) {
+			j = len(keys)
+		}
+
+		args := append([][]byte{[]byte("MGET")}, keys[i:j]...)
+		var reply interface{}
+		reply, err = conn.Do(args...)
+		if err != nil {
+			return
+		}
+		if err = respOK(reply); err != nil {
+			return
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != j-i {
+			return errRESPReply
+		}
+
+		for n, v := range values {
+			v, ok := v.([]byte)
+			if !ok {
+				continue // deleted since the SCAN
+			}
+			if err = fn(keys[i+n][len(respKeyPrefix):], v); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// scan returns every key with respKeyPrefix, in order.
+func (c *RESPCollection) scan(conn *respConn) (keys [][]byte, err error) {
+	match := append(append([]byte(nil), respKeyPrefix...), '*')
+	count := []byte(strconv.Itoa(respBatch))
+	cursor := []byte("0")
+	for {
+		var reply interface{}
+		reply, err = conn.Do([]byte("SCAN"), cursor, []byte("MATCH"), match, []byte("COUNT"), count)
+		if err != nil {
+			return
+		}
+		if err = respOK(reply); err != nil {
+			return
+		}
+
+		a, ok := reply.([]interface{})
+		if !ok || len(a) != 2 {
+			return nil, errRESPReply
+		}
+		next, ok := a[0].([]byte)
+		if !ok {
+			return nil, errRESPReply
+		}
+		page, ok := a[1].([]interface{})
+		if !ok {
+			return nil, errRESPReply
+		}
+		for _, k := range page {
+			if k, ok := k.([]byte); ok {
+				keys = append(keys, k)
+			}
+		}
+
+		// SCAN may return a key more than once,
+		// duplicates are removed after sorting
+		if string(next) == "0" {
+			return dedup(keys), nil
+		}
+		cursor = next
+	}
+}
+
+func dedup(keys [][]byte) [][]byte {
+	sort.Sort(byteSlices(keys))
+	out := keys[:0]
+	for i, k := range keys {
+		if i == 0 || !bytes.Equal(k, keys[i-1]) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+type byteSlices [][]byte
+
+func (s byteSlices) Len() int           { return len(s) }
+func (s byteSlices) Less(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+func (s byteSlices) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (c *RESPCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	conn, err := c.get()
+	if err != nil {
+		return
+	}
+	release := conn.watch(ctx)
+	defer func() {
+		release()
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.put(conn, err)
+	}()
+
+	// pipeline one MSET per batch of rows, then
+	// read all of the replies
+	sent := 0
+	for i := 0; i < len(rows); i += respBatch {
+		j := i + respBatch
+		if j > len(rows) {
+			j = len(rows)
+		}
+
+		args := make([][]byte, 1, 1+2*(j-i))
+		args[0] = []byte("MSET")
+		for _, row := range rows[i:j] {
+			var bk, bv []byte
+
+			bk, err = row.Key.Bytes()
+			if err != nil {
+				return
+			}
+
+			bv, err = row.Value.Bytes()
+			if err != nil {
+				return
+			}
+
+			args = append(args, append(append([]byte(nil), respKeyPrefix...), bk...), bv)
+		}
+
+		if err = conn.Send(args...); err != nil {
+			return
+		}
+		sent++
+	}
+
+	if err = conn.Flush(); err != nil {
+		return
+	}
+	return receiveAll(conn, sent)
+}
+
+// receiveAll reads n pipelined replies, returning the
+// first error reply after all have been read.
+func receiveAll(conn *respConn, n int) (err error) {
+	for i := 0; i < n; i++ {
+		reply, rerr := conn.Receive()
+		if rerr != nil {
+			return rerr
+		}
+		if rerr = respOK(reply); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return
+}
+
+func (c *RESPCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	conn, err := c.get()
+	if err != nil {
+		return
+	}
+	release := conn.watch(ctx)
+	defer func() {
+		release()
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.put(conn, err)
+	}()
+
+	reply, err := conn.Do([]byte("DEL"), append(append([]byte(nil), respKeyPrefix...), bk...))
+	if err != nil {
+		return
+	}
+	return respOK(reply)
+}
+
+func (c *RESPCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+// respInfoFields are the fields of the INFO reply
+// reported by Stats.
+var respInfoFields = []string{
+	"used_memory",
+	"used_memory_rss",
+	"mem_fragmentation_ratio",
+	"total_commands_processed",
+	"total_net_input_bytes",
+	"total_net_output_bytes",
+	"expired_keys",
+	"evicted_keys",
+	"connected_clients",
+}
+
+func (c *RESPCollection) Stats() map[string]interface{} {
+	m := make(map[string]interface{})
+
+	conn, err := c.get()
+	if err != nil {
+		return m
+	}
+	defer func() { c.put(conn, err) }()
+
+	reply, err := conn.Do([]byte("INFO"))
+	if err != nil {
+		return m
+	}
+	info, ok := reply.([]byte)
+	if !ok {
+		return m
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(info))
+	for s.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(s.Text()), ":", 2)
+		if len(kv) != 2 || !contains(respInfoFields, kv[0]) {
+			continue
+		}
+		if n, err := strconv.ParseInt(kv[1], 10, 64); err == nil {
+			m[kv[0]] = n
+		} else if f, err := strconv.ParseFloat(kv[1], 64); err == nil {
+			m[kv[0]] = f
+		}
+	}
+	return m
+}
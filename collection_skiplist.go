@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	skiplistMaxLevel = 24 // enough for 2^24 rows at p = 1/2
+	skiplistP        = 0.5
+)
+
+type skiplistNode struct {
+	k, v []byte
+	next []*skiplistNode
+}
+
+// SkiplistCollection keeps rows in an in-memory skiplist
+// guarded by a single RWMutex.
+type SkiplistCollection struct {
+	sync.RWMutex
+	scanGroup
+	head  *skiplistNode
+	level int // levels in use
+	n     int // number of rows
+	rnd   *rand.Rand
+}
+
+func NewSkiplistCollection() (c Collection, err error) {
+	return &SkiplistCollection{
+		head:  &skiplistNode{next: make([]*skiplistNode, skiplistMaxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(1)),
+	}, nil
+}
+
+func (c *SkiplistCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	return nil
+}
+
+func (c *SkiplistCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *SkiplistCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	c.RLock()
+	defer c.RUnlock()
+
+	fn = withContext(ctx, fn)
+	for x := c.head.next[0]; x != nil; x = x.next[0] {
+		if err = fn(x.k, x.v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// find returns the last node before k at each level, and
+// the node holding k if there is one.  The caller must
+// hold the lock.
+func (c *SkiplistCollection) find(k []byte) (prev [skiplistMaxLevel]*skiplistNode, x *skiplistNode) {
+	p := c.head
+	for i := c.level - 1; i >= 0; i-- {
+		for p.next[i] != nil && bytes.Compare(p.next[i].k, k) < 0 {
+			p = p.next[i]
+		}
+		prev[i] = p
+	}
+	if x = p.next[0]; x != nil && !bytes.Equal(x.k, k) {
+		x = nil
+	}
+	return
+}
+
+func (c *SkiplistCollection) randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && c.rnd.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+func (c *SkiplistCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, row := range rows {
+		var bk, bv []byte
+
+		bk, err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		bv, err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+
+		prev, x := c.find(bk)
+		if x != nil {
+			x.v = bv
+			continue
+		}
+
+		level := c.randomLevel()
+		for i := c.level; i < level; i++ {
+			prev[i] = c.head
+		}
+		if level > c.level {
+			c.level = level
+		}
+
+		x = &skiplistNode{k: bk, v: bv, next: make([]*skiplistNode, level)}
+		for i := 0; i < level; i++ {
+			x.next[i] = prev[i].next[i]
+			prev[i].next[i] = x
+		}
+		c.n++
+	}
+	return
+}
+
+func (c *SkiplistCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	prev, x := c.find(bk)
+	if x == nil {
+		return
+	}
+
+	for i := range x.next {
+		prev[i].next[i] = x.next[i]
+	}
+	for c.level > 1 && c.head.next[c.level-1] == nil {
+		c.level--
+	}
+	c.n--
+	return
+}
+
+func (c *SkiplistCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.RLock()
+	_, x := c.find(k)
+	c.RUnlock()
+	if x == nil {
+		return
+	}
+	return x.v, true, nil
+}
+
+func (c *SkiplistCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *SkiplistCollection) Stats() map[string]interface{} {
+	c.RLock()
+	defer c.RUnlock()
+	return map[string]interface{}{"rows": c.n, "levels": c.level}
+}
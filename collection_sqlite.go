@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SQLiteOptions controls how a SQLiteCollection commits
+// transactions.  Journal is one of the journal_mode values
+// (delete, truncate, persist, memory, wal, off) and
+// Synchronous one of the synchronous levels (off, normal,
+// full, extra).
+type SQLiteOptions struct {
+	Journal     string
+	Synchronous string
+}
+
+// defaultSQLiteOptions are the options of a collection
+// opened without a journal mode or synchronous level.
+var defaultSQLiteOptions = SQLiteOptions{
+	Journal:     "wal",
+	Synchronous: "normal",
+}
+
+// withDefaults returns o with the options it does not set
+// taken from defaultSQLiteOptions.
+func (o SQLiteOptions) withDefaults() SQLiteOptions {
+	if o.Journal == "" {
+		o.Journal = defaultSQLiteOptions.Journal
+	}
+	if o.Synchronous == "" {
+		o.Synchronous = defaultSQLiteOptions.Synchronous
+	}
+	return o
+}
+
+var sqliteJournalModes = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+var sqliteSynchronous = []string{"off", "normal", "full", "extra"}
+
+// SQLiteCollection stores rows in a single WITHOUT ROWID
+// table of a SQLite database.
+type SQLiteCollection struct {
+	scanGroup
+	db *sql.DB
+}
+
+// NewSQLiteCollection opens the SQLite database at path
+// with opts, or the defaults if opts is nil.
+func NewSQLiteCollection(path string, opts *SQLiteOptions) (c Collection, err error) {
+	var o SQLiteOptions
+	if opts != nil {
+		o = *opts
+	}
+	o = o.withDefaults()
+
+	journal := strings.ToLower(o.Journal)
+	if !contains(sqliteJournalModes, journal) {
+		return nil, fmt.Errorf("invalid sqlite journal mode %q: expected one of %s",
+			o.Journal, strings.Join(sqliteJournalModes, ", "))
+	}
+	synchronous := strings.ToLower(o.Synchronous)
+	if !contains(sqliteSynchronous, synchronous) {
+		return nil, fmt.Errorf("invalid sqlite synchronous level %q: expected one of %s",
+			o.Synchronous, strings.Join(sqliteSynchronous, ", "))
+	}
+
+	// pragmas given in the DSN are applied to every
+	// connection the pool opens, which matters for
+	// synchronous and busy_timeout
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("journal_mode(%s)", journal))
+	q.Add("_pragma", fmt.Sprintf("synchronous(%s)", synchronous))
+	q.Add("_pragma", "busy_timeout(10000)")
+	dsn := "file:" + path + "?" + q.Encode()
+
+	sqlc := &SQLiteCollection{}
+
+	sqlc.db, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	_, err = sqlc.db.Exec("CREATE TABLE IF NOT EXISTS kv (k BLOB PRIMARY KEY, v BLOB) WITHOUT ROWID")
+	if err != nil {
+		sqlc.db.Close()
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	return sqlc, err
+}
+
+func (c *SQLiteCollection) Close(force bool) (err error) {
+	c.stopScans(force)
+	err = c.db.Close()
+	return
+}
+
+func (c *SQLiteCollection) Rows(ctx context.Context) (ch chan Row) {
+	return forEachRows(ctx, c)
+}
+
+func (c *SQLiteCollection) ForEach(ctx context.Context, fn func(k, v []byte) error) (err error) {
+	if err = c.beginScan(); err != nil {
+		return
+	}
+	defer c.endScan()
+
+	rows, err := c.db.QueryContext(ctx, "SELECT k, v FROM kv ORDER BY k")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	// RawBytes refer to the driver's memory and are
+	// only valid until the next call to Next
+	var k, v sql.RawBytes
+	for rows.Next() {
+		if err = rows.Scan(&k, &v); err != nil {
+			return
+		}
+		if err = fn(k, v); err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
+
+func (c *SQLiteCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT OR REPLACE INTO kv (k, v) VALUES (?, ?)")
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		var bk, bv []byte
+
+		bk, err = row.Key.Bytes()
+		if err != nil {
+			return
+		}
+
+		bv, err = row.Value.Bytes()
+		if err != nil {
+			return
+		}
+
+		_, err = stmt.ExecContext(ctx, bk, bv)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *SQLiteCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	var bk []byte
+	bk, err = k.Bytes()
+	if err != nil {
+		return
+	}
+
+	_, err = c.db.ExecContext(ctx, "DELETE FROM kv WHERE k = ?", bk)
+	return
+}
+
+func (c *SQLiteCollection) Get(ctx context.Context, k []byte) (v []byte, found bool, err error) {
+	err = c.db.QueryRowContext(ctx, "SELECT v FROM kv WHERE k = ?", k).Scan(&v)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	return v, err == nil, err
+}
+
+func (c *SQLiteCollection) Timing(ctx context.Context) (int, int64, time.Duration) {
+	t0 := time.Now()
+	n, size := 0, int64(0)
+	for row := range c.Rows(ctx) {
+		n++
+		size += row.Size()
+	}
+	t1 := time.Now()
+	return n, size, t1.Sub(t0)
+}
+
+func (c *SQLiteCollection) Stats() map[string]interface{} {
+	m := make(map[string]interface{})
+
+	for _, p := range []string{"page_count", "freelist_count", "page_size"} {
+		var n int64
+		if err := c.db.QueryRow("PRAGMA " + p).Scan(&n); err == nil {
+			m[p] = n
+		}
+	}
+
+	s := c.db.Stats()
+	m["open_connections"] = s.OpenConnections
+	m["in_use"] = s.InUse
+	m["wait_count"] = s.WaitCount
+	m["wait_duration"] = s.WaitDuration
+
+	return m
+}
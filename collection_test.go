@@ -2,9 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 var testRows = make([]*Row, 0, 254)
@@ -63,6 +68,189 @@ func TestCollectionBolt(t *testing.T) {
 	}
 }
 
+func TestCollectionBBolt(t *testing.T) {
+	fh, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fh.Name())
+	defer fh.Close()
+
+	c, err := NewBBoltCollection(fh.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "bbolt", c)
+
+	err = c.Close(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectionPebble(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	c, err := NewPebbleCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "pebble", c)
+
+	err = c.Close(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectionBadger(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	c, err := NewBadgerCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "badger", c)
+
+	err = c.Close(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectionSQLite(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	for _, journal := range []string{"wal", "delete"} {
+		opts := &SQLiteOptions{Journal: journal, Synchronous: "normal"}
+		c, err := NewSQLiteCollection(filepath.Join(path, journal+".db"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testCollection(t, "sqlite-"+journal, c)
+
+		err = c.Close(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = NewSQLiteCollection(filepath.Join(path, "x.db"), &SQLiteOptions{Journal: "wal", Synchronous: "sometimes"})
+	if err == nil {
+		t.Error("expected an error for an invalid synchronous level")
+	}
+}
+
+func TestCollectionMap(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "map", c)
+}
+
+func TestCollectionBTree(t *testing.T) {
+	c, err := NewBTreeCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "btree", c)
+}
+
+func TestCollectionSkiplist(t *testing.T) {
+	c, err := NewSkiplistCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "skiplist", c)
+}
+
+// TestCollectionReference applies the same random sets and
+// deletes to each in-memory collection and checks that they
+// agree on the result.
+func TestCollectionReference(t *testing.T) {
+	ids := []string{"map", "btree", "skiplist"}
+	cs := make([]Collection, len(ids))
+	for i, id := range ids {
+		var err error
+		cs[i], err = openCollection(id, "", true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rnd := NewRandom(99)
+	buf := &bytes.Buffer{}
+	var keys []RowKey
+	for i := 0; i < 100; i++ {
+		rows := make([]*Row, rnd.Int(1, 50))
+		for j := range rows {
+			buf.Reset()
+			if err := rnd.Bytes(buf, rnd.Int(1, 4)); err != nil {
+				t.Fatal(err)
+			}
+			rk, _ := DecodeRowKey(buf.Bytes())
+			rv, _ := DecodeRowValue([]byte{byte(i), byte(j)})
+			rows[j] = &Row{Key: rk, Value: rv}
+			keys = append(keys, rk)
+		}
+		for _, c := range cs {
+			if err := c.Set(context.Background(), rows); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		k := keys[rnd.Int(0, len(keys))]
+		for _, c := range cs {
+			if err := c.Delete(context.Background(), k); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var expected [][]byte
+	cs[0].ForEach(context.Background(), func(k, v []byte) error {
+		expected = append(expected, append(append([]byte(nil), k...), v...))
+		return nil
+	})
+	for i := 1; i < len(cs); i++ {
+		var arrived [][]byte
+		cs[i].ForEach(context.Background(), func(k, v []byte) error {
+			arrived = append(arrived, append(append([]byte(nil), k...), v...))
+			return nil
+		})
+		if len(arrived) != len(expected) {
+			t.Errorf("%s returned %d rows, %s returned %d", ids[i], len(arrived), ids[0], len(expected))
+			continue
+		}
+		for j := range arrived {
+			if bytes.Compare(arrived[j], expected[j]) != 0 {
+				t.Errorf("%s row %d = %v, %s row %d = %v", ids[i], j, arrived[j], ids[0], j, expected[j])
+				break
+			}
+		}
+	}
+}
+
 func TestCollectionKV(t *testing.T) {
 	path, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -97,9 +285,99 @@ func TestCollectionKV(t *testing.T) {
 	}
 }
 
+// TestCollectionAbandonedRows checks that a scan whose
+// consumer stops reading ends its read transaction once its
+// context is cancelled, which bolt waits for when closing.
+func TestCollectionAbandonedRows(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	c, err := NewBoltCollection(filepath.Join(path, "bolt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more rows than the channel buffers
+	rows := make([]*Row, 3000)
+	for i := range rows {
+		rows[i] = &Row{
+			Key:   RowKey{b: []byte(fmt.Sprintf("%08d", i))},
+			Value: &RowValue{b: []byte("v")},
+		}
+	}
+	if err = c.Set(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.Rows(ctx)
+	<-ch
+	cancel()
+
+	// Close(false) waits for the scan to end, which it
+	// does once the scan sees the context is done
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close(false)
+	}()
+	select {
+	case err = <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close(false) blocked on the abandoned scan")
+	}
+
+	// the scan has ended, closing its channel, by the time
+	// Close returns
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		default:
+			t.Fatal("Close returned before the scan ended")
+		}
+	}
+}
+
+// TestCollectionClosedScan checks that no scan begins once
+// a collection is closing.
+func TestCollectionClosedScan(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(false); err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.ForEach(context.Background(), func(k, v []byte) error { return nil })
+	if err != errClosed {
+		t.Errorf("ForEach: expected %v, got %v", errClosed, err)
+	}
+
+	var rows []Row
+	for row := range c.Rows(context.Background()) {
+		rows = append(rows, row)
+	}
+	if len(rows) != 1 || rows[0].Err != errClosed {
+		t.Errorf("Rows: expected one row with %v, got %v", errClosed, rows)
+	}
+}
+
 func testCollection(t *testing.T, id string, c Collection) {
 	testCollectionSet(t, id, c)
 	testCollectionRows(t, id, c)
+	testCollectionForEach(t, id, c)
+	testCollectionGet(t, id, c)
+	testCollectionCancel(t, id, c)
+	testCollectionStats(t, id, c)
 	testCollectionDelete(t, id, c)
 }
 
@@ -107,7 +385,7 @@ func testCollectionSet(t *testing.T, id string, c Collection) {
 	if len(testRows) == 0 {
 		t.Fatal("zero testRows: did initialization fail?")
 	}
-	err := c.Set(testRows)
+	err := c.Set(context.Background(), testRows)
 	if err != nil {
 		t.Error(id, "Set", err)
 	}
@@ -117,7 +395,7 @@ func testCollectionRows(t *testing.T, id string, c Collection) {
 	if len(testRows) == 0 {
 		t.Fatal("zero testRows: did initialization fail?")
 	}
-	ch := c.Rows()
+	ch := c.Rows(context.Background())
 	arrived := make([]Row, 0, len(testRows))
 	for rows := range ch {
 		arrived = append(arrived, rows)
@@ -138,18 +416,108 @@ func testCollectionRows(t *testing.T, id string, c Collection) {
 	}
 }
 
+func testCollectionForEach(t *testing.T, id string, c Collection) {
+	if len(testRows) == 0 {
+		t.Fatal("zero testRows: did initialization fail?")
+	}
+	i := 0
+	err := c.ForEach(context.Background(), func(k, v []byte) error {
+		if i < len(testRows) {
+			if bytes.Compare(k, testRows[i].Key.b) != 0 {
+				t.Errorf("%s ForEach key mismatch on row %d:\narrived = %v\nexpected = %v",
+					id, i, k, testRows[i].Key.b)
+			}
+			if bytes.Compare(v, testRows[i].Value.b) != 0 {
+				t.Errorf("%s ForEach value mismatch on row %d:\narrived = %v\nexpected = %v",
+					id, i, v, testRows[i].Value.b)
+			}
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Error(id, "ForEach:", err)
+	}
+	if i != len(testRows) {
+		t.Errorf("%s ForEach failed: expected %d rows, got %d", id, len(testRows), i)
+	}
+
+	stop := errors.New("stop")
+	i = 0
+	err = c.ForEach(context.Background(), func(k, v []byte) error {
+		i++
+		return stop
+	})
+	if err != stop || i != 1 {
+		t.Errorf("%s ForEach did not stop on error: got %v after %d rows", id, err, i)
+	}
+}
+
+func testCollectionGet(t *testing.T, id string, c Collection) {
+	for _, i := range []int{0, len(testRows) / 2, len(testRows) - 1} {
+		v, found, err := getValue(context.Background(), c, testRows[i].Key.b)
+		if err != nil || !found || !bytes.Equal(v, testRows[i].Value.b) {
+			t.Errorf("%s Get of row %d returned %v, %v, %v", id, i, v, found, err)
+		}
+	}
+	v, found, err := getValue(context.Background(), c, []byte("missing"))
+	if err != nil || found {
+		t.Errorf("%s Get of a missing key returned %v, %v, %v", id, v, found, err)
+	}
+}
+
+func testCollectionCancel(t *testing.T, id string, c Collection) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.ForEach(ctx, func(k, v []byte) error {
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("%s ForEach: expected %v, got %v", id, context.Canceled, err)
+	}
+
+	if err = c.Set(ctx, testRows[:1]); err == nil {
+		t.Errorf("%s Set: expected an error from a cancelled context", id)
+	}
+
+	ch := c.Rows(ctx)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				continue
+			}
+		case <-timeout:
+			t.Fatalf("%s Rows: channel not closed after the context was cancelled", id)
+		}
+		break
+	}
+}
+
+func testCollectionStats(t *testing.T, id string, c Collection) {
+	sc, ok := c.(StatsCollection)
+	if !ok {
+		return
+	}
+	if stats := sc.Stats(); len(stats) == 0 {
+		t.Errorf("%s Stats returned no statistics after Set", id)
+	}
+}
+
 func testCollectionDelete(t *testing.T, id string, c Collection) {
 	if len(testRows) == 0 {
 		t.Fatal("zero testRows: did initialization fail?")
 	}
 	for i, row := range testRows {
-		err := c.Delete(row.Key)
+		err := c.Delete(context.Background(), row.Key)
 		if err != nil {
 			t.Errorf(id, "Delete:", err)
 			continue
 		}
 
-		for v := range c.Rows() {
+		for v := range c.Rows(context.Background()) {
 			if bytes.Compare(v.Key.b, row.Key.b) == 0 {
 				t.Errorf("%s Rows returned key %v (#%d) after Delete", id, row.Key.b, i)
 			}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardHistory is the number of values shown in each
+// sparkline, and of samples the arrival rate is averaged over.
+const dashboardHistory = 40
+
+// dashboardLogLines is the number of recent log lines shown.
+const dashboardLogLines = 8
+
+// Dashboard renders a live view of a running Benchmark to
+// a terminal: the arrival rate of row sets against the
+// target, the writer backlog, write and scan throughput,
+// latency percentiles, disk usage and garbage collection.
+// While it runs it takes over the log output, showing the
+// most recent lines below the view.
+type Dashboard struct {
+	w      io.Writer
+	b      *Benchmark
+	label  string
+	target time.Duration // mean inter-arrival time sent
+	start  time.Time
+
+	samples []LiveSample // recent samples, oldest first
+	writes  []float64    // rows written per second
+	scans   []float64    // rows scanned per ms
+
+	mu   sync.Mutex
+	logs []string // recent log lines
+	part string   // incomplete log line
+}
+
+// NewDashboard returns a Dashboard of b writing to w.  Row
+// sets are expected to arrive every target on average.
+func NewDashboard(w io.Writer, b *Benchmark, label string, target time.Duration) *Dashboard {
+	return &Dashboard{w: w, b: b, label: label, target: target, start: time.Now()}
+}
+
+// Write keeps the most recent lines written to the
+// dashboard, which is the log output while it runs.
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := strings.Split(d.part+string(p), "\n")
+	d.part = lines[len(lines)-1]
+	d.logs = append(d.logs, lines[:len(lines)-1]...)
+	if n := len(d.logs) - dashboardLogLines; n > 0 {
+		d.logs = d.logs[n:]
+	}
+	return len(p), nil
+}
+
+// Start renders the dashboard every interval until the
+// returned stop is called, which renders it a final time
+// and restores the log output.
+func (d *Dashboard) Start(interval time.Duration) (stop func()) {
+	log.SetOutput(d)
+	quit, exited := make(chan bool), make(chan bool)
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			d.refresh()
+			select {
+			case <-t.C:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+		d.refresh()
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// refresh samples the benchmark and redraws the screen.
+func (d *Dashboard) refresh() {
+	d.update(d.b.Live())
+	fmt.Fprint(d.w, "\x1b[H\x1b[2J"+d.render())
+}
+
+// update adds s to the history of samples.
+func (d *Dashboard) update(s LiveSample) {
+	if n := len(d.samples); n > 0 {
+		prev := d.samples[n-1]
+		if dt := s.Time.Sub(prev.Time).Seconds(); dt > 0 {
+			d.writes = appendHistory(d.writes, float64(s.Rows-prev.Rows)/dt)
+		}
+		scanTime := s.ScanLatency.Sum - prev.ScanLatency.Sum
+		if s.Scans > prev.Scans && scanTime > 0 {
+			sec := float64(scanTime) / float64(time.Second)
+			d.scans = appendHistory(d.scans, float64(s.Scanned-prev.Scanned)/sec)
+		}
+	}
+	d.samples = append(d.samples, s)
+	if n := len(d.samples) - dashboardHistory; n > 0 {
+		d.samples = d.samples[n:]
+	}
+}
+
+func appendHistory(xs []float64, x float64) []float64 {
+	xs = append(xs, x)
+	if n := len(xs) - dashboardHistory; n > 0 {
+		xs = xs[n:]
+	}
+	return xs
+}
+
+// render returns the dashboard for the latest sample.
+func (d *Dashboard) render() string {
+	if len(d.samples) == 0 {
+		return ""
+	}
+	s, first := d.samples[len(d.samples)-1], d.samples[0]
+	buf := &strings.Builder{}
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(buf, format+"\n", args...)
+	}
+
+	line("kvbench %s, %s elapsed", d.label, s.Time.Sub(d.start).Round(time.Second))
+	line("")
+
+	arrival := "n/a"
+	if dt := s.Time.Sub(first.Time).Seconds(); dt > 0 {
+		arrival = fmt.Sprintf("%.2f/s", float64(s.Arrived-first.Arrived)/dt)
+	}
+	target := "n/a"
+	if d.target > 0 {
+		target = fmt.Sprintf("%.2f/s", float64(time.Second)/float64(d.target))
+	}
+	line("arrivals  %s row sets, target %s, backlog %d row sets", arrival, target, s.Backlog)
+
+	rate := 0.0
+	if len(d.writes) > 0 {
+		rate = d.writes[len(d.writes)-1]
+	}
+	line("writes    %d row sets, %d rows, %.0f rows/s %s", s.RowSets, s.Rows, rate, sparkline(d.writes))
+	line("          set latency %s", formatQuantiles(s.SetLatency))
+
+	rate = 0
+	if len(d.scans) > 0 {
+		rate = d.scans[len(d.scans)-1]
+	}
+	line("scans     %d scans, %d rows, %.0f rows/s %s", s.Scans, s.Scanned, rate, sparkline(d.scans))
+	if s.Timeouts > 0 {
+		line("          scan latency %s, %d timed out", formatQuantiles(s.ScanLatency), s.Timeouts)
+	} else {
+		line("          scan latency %s", formatQuantiles(s.ScanLatency))
+	}
+
+	if s.Disk != nil {
+		wa := "n/a"
+		if s.Disk.Written >= 0 {
+			wa = fmt.Sprintf("%.2f", s.Disk.WriteAmp())
+		}
+		line("disk      %s in %d files, write amplification %s, space amplification %.2f",
+			formatBytes(s.Disk.Bytes), s.Disk.Files, wa, s.Disk.SpaceAmp())
+	} else {
+		line("disk      n/a")
+	}
+
+	r := s.Resources
+	line("memory    rss %s, heap %s of %s", formatBytes(r.RSS), formatBytes(int64(r.HeapAlloc)), formatBytes(int64(r.HeapSys)))
+	line("gc        %d cycles, %s paused", r.NumGC, r.PauseTotal.Round(time.Microsecond))
+
+	d.mu.Lock()
+	logs := append([]string(nil), d.logs...)
+	d.mu.Unlock()
+	if len(logs) > 0 {
+		line("")
+		for _, l := range logs {
+			line("%s", l)
+		}
+	}
+	return buf.String()
+}
+
+// sparkline draws xs as a row of bars scaled to their maximum.
+func sparkline(xs []float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	var max float64
+	for _, x := range xs {
+		if x > max {
+			max = x
+		}
+	}
+	s := make([]rune, len(xs))
+	for i, x := range xs {
+		j := 0
+		if max > 0 && x > 0 {
+			j = int(x / max * float64(len(bars)-1))
+		}
+		s[i] = bars[j]
+	}
+	return string(s)
+}
+
+func formatQuantiles(h HistogramSnapshot) string {
+	if h.Count == 0 {
+		return "n/a"
+	}
+	q := func(p float64) time.Duration { return h.Quantile(p).Round(time.Microsecond) }
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s (%d)", q(0.5), q(0.9), q(0.99), h.Count)
+}
+
+// formatBytes formats n in binary units, or n/a if negative.
+func formatBytes(n int64) string {
+	if n < 0 {
+		return "n/a"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBenchmark("map", "", c)
+
+	buf := &bytes.Buffer{}
+	if err := NewRandom(3).Write(buf, 20, 1, 10, 4, 8, 4, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	d := NewDashboard(out, b, "map", 10*time.Millisecond)
+	ch := make(chan []*Row, 100)
+	b.Run(ch, 5*time.Millisecond)
+	stop := d.Start(time.Millisecond)
+	NewRandom(3).Send(ch, buf, 0, 0)
+	close(ch)
+	b.Wait()
+	log.Print("finished")
+	stop()
+
+	s := b.Live()
+	if s.Arrived != 20 || s.RowSets != 20 || s.SetLatency.Count != 20 || s.Scans == 0 {
+		t.Errorf("expected 20 row sets written and scans counted, got %+v", s)
+	}
+
+	frame := out.String()
+	frame = frame[strings.LastIndex(frame, "\x1b[2J"):]
+	for _, want := range []string{
+		"kvbench map",
+		"target 100.00/s",
+		"writes    20 row sets",
+		"set latency p50",
+		"scan latency p50",
+		"disk      n/a",
+		"finished",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("expected %q in the dashboard:\n%s", want, frame)
+		}
+	}
+
+	// the log output is restored
+	log.SetOutput(buf)
+	log.Print("after")
+	log.SetOutput(os.Stderr)
+	if strings.Contains(d.render(), "after") {
+		t.Errorf("expected the dashboard to stop taking log output")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if s := sparkline([]float64{0, 1, 2, 4}); s != "▁▂▄█" {
+		t.Errorf("unexpected sparkline %q", s)
+	}
+	if s := sparkline([]float64{0, 0}); s != "▁▁" {
+		t.Errorf("unexpected sparkline %q", s)
+	}
+}
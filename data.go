@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math/rand"
 	"sync"
@@ -25,6 +26,17 @@ func NewRandom(seed int64) *Random {
 	}
 }
 
+// NewStream returns a Random for the stream of seed named
+// name.  The streams of a seed are independent of each other
+// and of NewRandom(seed), which generates the data file, so
+// that drawing more from one, such as inter-arrival times,
+// does not shift the draws of another.
+func NewStream(seed int64, name string) *Random {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return NewRandom(seed ^ int64(h.Sum64()))
+}
+
 // Int returns a pseudo-random int between min
 // and max.  If max-min is < 1, the result will be min.
 func (rnd *Random) Int(min, max int) int {
@@ -49,6 +61,14 @@ func (rnd *Random) Bytes(w io.Writer, n int) error {
 	return binary.Write(w, binary.LittleEndian, buf)
 }
 
+// Shuffle pseudo-randomizes the order of n elements,
+// using swap to swap the elements with indexes i and j.
+func (rnd *Random) Shuffle(n int, swap func(i, j int)) {
+	rnd.Lock()
+	defer rnd.Unlock()
+	rnd.r.Shuffle(n, swap)
+}
+
 // Write writes pseudo-random benchmark data
 // to w based on the parameters provided
 // - rnd provides a source of pseudo-random data
@@ -87,12 +107,83 @@ func (rnd *Random) Write(w io.Writer, n, b0, b1, k0, k1, v0, v1 int) (err error)
 	return
 }
 
+// ReadRows reads one record block, as written by Write,
+// from br.  It returns io.EOF when no blocks remain.
+func ReadRows(br *bufio.Reader) (rows []*Row, err error) {
+	var x int64
+	if err = binary.Read(br, binary.LittleEndian, &x); err != nil {
+		return
+	}
+
+	rows = make([]*Row, 0, int(x))
+	for i := 0; i < int(x); i++ {
+		var k int64
+		if err = binary.Read(br, binary.LittleEndian, &k); err != nil {
+			err = fmt.Errorf("error reading key length: %v", err)
+			return
+		}
+
+		kbuf := make([]byte, int(k))
+		if err = binary.Read(br, binary.LittleEndian, kbuf); err != nil {
+			return
+		}
+
+		var v int64
+		if err = binary.Read(br, binary.LittleEndian, &v); err != nil {
+			return
+		}
+
+		vbuf := make([]byte, int(v))
+		if err = binary.Read(br, binary.LittleEndian, vbuf); err != nil {
+			return
+		}
+
+		var rk RowKey
+		rk, err = DecodeRowKey(kbuf)
+		if err != nil {
+			return
+		}
+
+		var rv *RowValue
+		rv, err = DecodeRowValue(vbuf)
+		if err != nil {
+			return
+		}
+
+		rows = append(rows, &Row{Key: rk, Value: rv})
+	}
+	return
+}
+
 // Send reads record blocks from r and sends them to ch.
 // At least d0 duration will pass in-between sends on ch, and
 // an attempt will be made to send within d1 duration.  Note
 // that d1 is not guaranteed, as there are external factors
 // that will affect how quickly each row can be prepared.
 func (rnd *Random) Send(ch chan []*Row, r io.Reader, d0, d1 time.Duration) (err error) {
+	return rnd.SendUntil(ch, r, d0, d1, time.Time{}, nil)
+}
+
+// SendUntil is like Send, but stops and returns nil once
+// deadline has passed, unless deadline is zero, or once stop
+// is closed, unless stop is nil.
+func (rnd *Random) SendUntil(ch chan []*Row, r io.Reader, d0, d1 time.Duration, deadline time.Time, stop <-chan bool) (err error) {
+	return sendRows(ch, r, rnd.arrivals(d0, d1), deadline, stop, nil)
+}
+
+// arrivals returns pseudo-random inter-arrival times
+// between d0 and d1.
+func (rnd *Random) arrivals(d0, d1 time.Duration) func() (time.Duration, bool) {
+	return func() (time.Duration, bool) {
+		return time.Duration(rnd.Int(int(d0), int(d1))), true
+	}
+}
+
+// sendRows reads record blocks from r and sends them to ch
+// as SendUntil does, waiting the inter-arrival time returned
+// by next between sends, and recording each send to tr.  It
+// returns nil when next returns false.
+func sendRows(ch chan []*Row, r io.Reader, next func() (time.Duration, bool), deadline time.Time, stop <-chan bool, tr *Trace) (err error) {
 	br, ok := r.(*bufio.Reader)
 	if !ok {
 		br = bufio.NewReader(r)
@@ -100,62 +191,43 @@ func (rnd *Random) Send(ch chan []*Row, r io.Reader, d0, d1 time.Duration) (err
 
 	// t0 will be the last send time
 	var t0 time.Time
+	var n int64
 	for {
-		var x int64
-		if err = binary.Read(br, binary.LittleEndian, &x); err != nil {
+		var rows []*Row
+		if rows, err = ReadRows(br); err != nil {
 			return
 		}
 
-		rows := make([]*Row, 0, int(x))
-		for i := 0; i < int(x); i++ {
-			var k int64
-			if err = binary.Read(br, binary.LittleEndian, &k); err != nil {
-				err = fmt.Errorf("error reading key length: %v", err)
-				return
-			}
-
-			kbuf := make([]byte, int(k))
-			if err = binary.Read(br, binary.LittleEndian, kbuf); err != nil {
-				return
-			}
-
-			var v int64
-			if err = binary.Read(br, binary.LittleEndian, &v); err != nil {
-				return
-			}
-
-			vbuf := make([]byte, int(v))
-			if err = binary.Read(br, binary.LittleEndian, vbuf); err != nil {
-				return
-			}
-
-			var rk RowKey
-			rk, err = DecodeRowKey(kbuf)
-			if err != nil {
-				return
-			}
-
-			var rv *RowValue
-			rv, err = DecodeRowValue(vbuf)
-			if err != nil {
-				return
+		var delay time.Duration
+		if !t0.IsZero() {
+			if delay, ok = next(); !ok {
+				return nil
 			}
 
-			rows = append(rows, &Row{Key: rk, Value: rv})
-		}
-
-		if !t0.IsZero() {
 			// t1 is the elapsed time since the last send
 			// if it is greater than our randomly computed
 			// delay, sleep for the difference
 			t1 := time.Now().Sub(t0)
-			ns := int64(rnd.Int(int(d0), int(d1))) - t1.Nanoseconds()
+			ns := delay.Nanoseconds() - t1.Nanoseconds()
 			if ns > 0 {
-				time.Sleep(time.Duration(ns))
+				select {
+				case <-time.After(time.Duration(ns)):
+				case <-stop:
+					return nil
+				}
 			}
 		}
 
 		t0 = time.Now()
-		ch <- rows
+		if !deadline.IsZero() && t0.After(deadline) {
+			return nil
+		}
+		select {
+		case ch <- rows:
+			n++
+			tr.Record(TraceOp{Op: "send", Seq: n, Delay: delay, Rows: len(rows)})
+		case <-stop:
+			return nil
+		}
 	}
 }
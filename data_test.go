@@ -44,6 +44,37 @@ func TestRandomInt(t *testing.T) {
 	}
 }
 
+func TestNewStream(t *testing.T) {
+	draw := func(rnd *Random) (v []int) {
+		for i := 0; i < 20; i++ {
+			v = append(v, rnd.Int(0, 1<<30))
+		}
+		return
+	}
+	eq := func(a, b []int) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	arrival := draw(NewStream(5, "arrival"))
+	if !eq(arrival, draw(NewStream(5, "arrival"))) {
+		t.Errorf("expected a stream to repeat for the same seed")
+	}
+	for _, other := range [][]int{
+		draw(NewRandom(5)),
+		draw(NewStream(5, "shuffle")),
+		draw(NewStream(6, "arrival")),
+	} {
+		if eq(arrival, other) {
+			t.Errorf("expected streams of other names and seeds to differ, got %v", other)
+		}
+	}
+}
+
 func TestRandomWriteSend(t *testing.T) {
 
 	seed := int64(99)
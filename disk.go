@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DiskSample records the storage footprint of a database
+// and the bytes written on its behalf at one point in time.
+type DiskSample struct {
+	Bytes   int64 // apparent size of the files under the database path
+	Files   int   // number of files under the database path
+	Written int64 // bytes written to storage since the benchmark started, -1 if unknown
+	Logical int64 // key and value bytes passed to Collection.Set
+	Live    int64 // key and value bytes of the rows visited by the last completed scan
+}
+
+// WriteAmp returns the ratio of bytes written to storage
+// to logical bytes written, or 0 if either is unknown.
+func (s DiskSample) WriteAmp() float64 {
+	if s.Written < 0 || s.Logical == 0 {
+		return 0
+	}
+	return float64(s.Written) / float64(s.Logical)
+}
+
+// SpaceAmp returns the ratio of bytes on disk to live
+// logical bytes, or 0 if the collection is empty.
+func (s DiskSample) SpaceAmp() float64 {
+	if s.Live == 0 {
+		return 0
+	}
+	return float64(s.Bytes) / float64(s.Live)
+}
+
+func (s DiskSample) String() string {
+	wa := "n/a"
+	if s.Written >= 0 {
+		wa = fmt.Sprintf("%.2f", s.WriteAmp())
+	}
+	return fmt.Sprintf("%d bytes on disk in %d files, %d logical bytes written, %d live: write amplification %s, space amplification %.2f",
+		s.Bytes, s.Files, s.Logical, s.Live, wa, s.SpaceAmp())
+}
+
+// DiskUsage returns the total size and number of regular
+// files at path, which may be a file or a directory.
+func DiskUsage(path string) (n int64, files int, err error) {
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// files may be removed by a compaction
+			// while we are walking the directory
+			if os.IsNotExist(err) && p != path {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			n += fi.Size()
+			files++
+		}
+		return nil
+	})
+	return
+}
+
+// procWriteBytes returns the number of bytes this process
+// has caused to be written to storage, as reported by
+// /proc/self/io.
+func procWriteBytes() (n int64, err error) {
+	fh, err := os.Open("/proc/self/io")
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	return parseProcIO(fh, "write_bytes")
+}
+
+// parseProcIO returns the value of field from r, which
+// is expected to be in the /proc/[pid]/io format.
+func parseProcIO(r io.Reader, field string) (n int64, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) == 2 && kv[0] == field {
+			return strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		}
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+	return 0, fmt.Errorf("%s not found", field)
+}
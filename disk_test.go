@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	err = os.Mkdir(filepath.Join(path, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]int{"a": 10, "b": 0, "sub/c": 32}
+	for name, n := range files {
+		err = ioutil.WriteFile(filepath.Join(path, name), make([]byte, n), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, count, err := DiskUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 || count != 3 {
+		t.Errorf("expected 42 bytes in 3 files, got %d bytes in %d files", n, count)
+	}
+
+	n, count, err = DiskUsage(filepath.Join(path, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || count != 1 {
+		t.Errorf("expected 10 bytes in 1 file, got %d bytes in %d files", n, count)
+	}
+
+	_, _, err = DiskUsage(filepath.Join(path, "missing"))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestParseProcIO(t *testing.T) {
+	io := `rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 0
+write_bytes: 323932160
+cancelled_write_bytes: 0
+`
+	n, err := parseProcIO(strings.NewReader(io), "write_bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 323932160 {
+		t.Errorf("expected 323932160, got %d", n)
+	}
+
+	_, err = parseProcIO(strings.NewReader(io), "missing")
+	if err == nil {
+		t.Error("expected an error for a missing field")
+	}
+}
+
+func TestBenchmarkAccount(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	c, err := NewBoltCollection(filepath.Join(path, "bolt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(true)
+	b := newBenchmark("bolt", filepath.Join(path, "bolt.db"), c)
+
+	// as Run does, where /proc/self/io is available
+	if n, err := procWriteBytes(); err == nil {
+		b.written = n
+	}
+
+	for _, rows := range [][]*Row{testRows, testRows[:10]} {
+		if err = c.Set(context.Background(), rows); err != nil {
+			t.Fatal(err)
+		}
+		b.account(rows)
+	}
+	if s := b.Live(); s.Disk != nil {
+		t.Fatal("expected no disk sample before a poll")
+	}
+	b.scanOnce(0)
+
+	s, err := b.Disk()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// testRows have one byte keys and values
+	if s.Logical != 2*264 || s.Live != 2*254 {
+		t.Errorf("expected %d logical and %d live bytes, got %+v", 2*264, 2*254, s)
+	}
+	if s.Bytes <= 0 || s.Files < 1 {
+		t.Errorf("expected the bolt file on disk, got %+v", s)
+	}
+	if b.written >= 0 && s.Written < 0 {
+		t.Errorf("expected the bytes written, got %+v", s)
+	}
+	if b.written < 0 && s.Written != -1 {
+		t.Errorf("expected no bytes written without /proc, got %+v", s)
+	}
+	if expected := float64(s.Written) / float64(s.Logical); s.Written >= 0 && s.WriteAmp() != expected {
+		t.Errorf("expected write amplification of %f, got %f", expected, s.WriteAmp())
+	}
+	if expected := float64(s.Bytes) / float64(s.Live); s.SpaceAmp() != expected {
+		t.Errorf("expected space amplification of %f, got %f", expected, s.SpaceAmp())
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultKind identifies the type of failure injected
+// into a database write.
+type FaultKind int
+
+const (
+	FaultENOSPC FaultKind = iota // no space left on device
+	FaultEIO                     // input/output error
+	FaultShort                   // torn write: half the bytes, then an error
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultENOSPC:
+		return "enospc"
+	case FaultEIO:
+		return "eio"
+	case FaultShort:
+		return "short"
+	}
+	return fmt.Sprintf("FaultKind(%d)", int(k))
+}
+
+// FaultSchedule decides which writes to a database file
+// should fail, and how.  The first after writes succeed,
+// after which every write fails (every == 0) or one out
+// of every writes fails (every > 0).
+type FaultSchedule struct {
+	sync.Mutex
+	kind   FaultKind
+	after  int64
+	every  int64
+	n      int64 // writes seen
+	faults int64 // writes failed
+}
+
+// ParseFaultSchedule parses a schedule of the form
+// kind@after or kind@after/every, where kind is one of
+// enospc, eio or short.  For example "enospc@1000" fails
+// every write after the first 1000, and "eio@500/10" fails
+// write 501 and every tenth write after it.
+func ParseFaultSchedule(spec string) (s *FaultSchedule, err error) {
+	s = &FaultSchedule{}
+
+	i := strings.Index(spec, "@")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid fault schedule %q: expected kind@after[/every]", spec)
+	}
+
+	switch spec[:i] {
+	case "enospc":
+		s.kind = FaultENOSPC
+	case "eio":
+		s.kind = FaultEIO
+	case "short":
+		s.kind = FaultShort
+	default:
+		return nil, fmt.Errorf("invalid fault schedule %q: unknown fault kind %q", spec, spec[:i])
+	}
+
+	after, every := spec[i+1:], ""
+	j := strings.Index(after, "/")
+	if j >= 0 {
+		after, every = after[:j], after[j+1:]
+	}
+
+	s.after, err = strconv.ParseInt(after, 10, 64)
+	if err != nil || s.after < 0 {
+		return nil, fmt.Errorf("invalid fault schedule %q: bad write count %q", spec, after)
+	}
+
+	if j >= 0 {
+		s.every, err = strconv.ParseInt(every, 10, 64)
+		if err != nil || s.every < 1 {
+			return nil, fmt.Errorf("invalid fault schedule %q: bad interval %q", spec, every)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FaultSchedule) String() string {
+	if s.every > 0 {
+		return fmt.Sprintf("%s@%d/%d", s.kind, s.after, s.every)
+	}
+	return fmt.Sprintf("%s@%d", s.kind, s.after)
+}
+
+// Faults returns the number of writes that have
+// been failed so far.
+func (s *FaultSchedule) Faults() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.faults
+}
+
+// fail reports whether the next write should fail.
+func (s *FaultSchedule) fail() bool {
+	s.Lock()
+	defer s.Unlock()
+	s.n++
+	if s.n <= s.after {
+		return false
+	}
+	if s.every > 0 && (s.n-s.after-1)%s.every != 0 {
+		return false
+	}
+	s.faults++
+	return true
+}
+
+// Write writes p to w unless the schedule calls for
+// a fault, in which case nothing (enospc, eio) or half
+// of p (short) is written and an error is returned.
+func (s *FaultSchedule) Write(w io.Writer, p []byte) (n int, err error) {
+	return s.WriteAt(func(p []byte, off int64) (int, error) {
+		return w.Write(p)
+	}, p, 0)
+}
+
+// WriteAt is like Write, but writes p at offset off
+// with writeAt.
+func (s *FaultSchedule) WriteAt(writeAt func(p []byte, off int64) (int, error), p []byte, off int64) (n int, err error) {
+	if !s.fail() {
+		return writeAt(p, off)
+	}
+
+	switch s.kind {
+	case FaultENOSPC:
+		return 0, syscall.ENOSPC
+	case FaultEIO:
+		return 0, syscall.EIO
+	}
+
+	n, err = writeAt(p[:len(p)/2], off)
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
+// faultIds are the backends whose database file writes
+// go through a faultFile.  The others are limited in size
+// with RLIMIT_FSIZE, which applies to every file the
+// process writes.
+var faultIds = []string{"bbolt", "bolt", "kv", "kv-mu", "leveldb"}
+
+// faultFile injects faults into the writes to a database
+// file: those called for by s, if not nil, and, if size is
+// more than 0, those that would grow the file past size
+// bytes, which fail with EFBIG as they would under an
+// RLIMIT_FSIZE of size.
+type faultFile struct {
+	s    *FaultSchedule
+	size int64
+}
+
+// WriteAt writes p at offset off with writeAt, unless
+// f calls for a fault.
+func (f faultFile) WriteAt(writeAt func(p []byte, off int64) (int, error), p []byte, off int64) (n int, err error) {
+	if f.size > 0 && off+int64(len(p)) > f.size {
+		if off < f.size {
+			n, err = writeAt(p[:f.size-off], off)
+		}
+		if err == nil {
+			err = syscall.EFBIG
+		}
+		return
+	}
+	if f.s == nil {
+		return writeAt(p, off)
+	}
+	return f.s.WriteAt(writeAt, p, off)
+}
+
+// faultCollection wraps a Collection opened with fault
+// injection, recording which rows were acknowledged by
+// Set, the first error Set returned, and when a write last
+// made progress.
+type faultCollection struct {
+	Collection
+	mu       sync.Mutex
+	acked    map[string]bool
+	err      error
+	failed   chan bool
+	inFlight int       // calls to Set that have not returned
+	last     time.Time // when a Set last returned, or the first in flight began
+}
+
+func newFaultCollection(c Collection) *faultCollection {
+	return &faultCollection{
+		Collection: c,
+		acked:      make(map[string]bool),
+		failed:     make(chan bool),
+	}
+}
+
+func (c *faultCollection) Set(ctx context.Context, rows []*Row) (err error) {
+	c.mu.Lock()
+	if c.inFlight == 0 {
+		c.last = time.Now()
+	}
+	c.inFlight++
+	c.mu.Unlock()
+
+	err = c.Collection.Set(ctx, rows)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.last = time.Now()
+
+	if err != nil {
+		if c.err == nil {
+			c.err = err
+			close(c.failed)
+		}
+		return
+	}
+
+	for _, row := range rows {
+		c.acked[string(row.Key.b)] = true
+	}
+	return
+}
+
+// progress returns when a write last made progress, and
+// whether a write is in flight.
+func (c *faultCollection) progress() (last time.Time, busy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last, c.inFlight > 0
+}
+
+func (c *faultCollection) Delete(ctx context.Context, k RowKey) (err error) {
+	err = c.Collection.Delete(ctx, k)
+	if err == nil {
+		c.mu.Lock()
+		delete(c.acked, string(k.b))
+		c.mu.Unlock()
+	}
+	return
+}
+
+func (c *faultCollection) Stats() map[string]interface{} {
+	if sc, ok := c.Collection.(StatsCollection); ok {
+		return sc.Stats()
+	}
+	return nil
+}
+
+// FaultReport describes how a backend and Benchmark.Writer
+// reacted to injected faults.
+type FaultReport struct {
+	Id        string
+	Schedule  string
+	Faults    int64 // writes failed by the schedule
+	Err       error // first error returned by Set
+	Hung      bool  // the backend blocked, so the benchmark did not finish before the deadline
+	Acked     int   // rows acknowledged by Set
+	Recovered int   // rows readable after reopening
+	Missing   int   // acknowledged rows not found after reopening
+	Corrupt   int   // rows that failed to decode after reopening
+	ReopenErr error // error reopening the database
+}
+
+// Outcome summarizes the report as one of "ok", "error",
+// "hang" or "corruption".
+func (r *FaultReport) Outcome() string {
+	switch {
+	case r.ReopenErr != nil || r.Missing > 0 || r.Corrupt > 0:
+		return "corruption"
+	case r.Hung:
+		return "hang"
+	case r.Err != nil:
+		return "error"
+	}
+	return "ok"
+}
+
+func (r *FaultReport) String() string {
+	s := fmt.Sprintf("%s: %s: %d faults injected (%s), %d rows acknowledged, %d recovered, %d missing, %d corrupt",
+		r.Id, r.Outcome(), r.Faults, r.Schedule, r.Acked, r.Recovered, r.Missing, r.Corrupt)
+	if r.Err != nil {
+		s += fmt.Sprintf("; Set error: %v", r.Err)
+	}
+	if r.Hung {
+		s += "; writer did not finish, database not verified"
+	}
+	if r.ReopenErr != nil {
+		s += fmt.Sprintf("; reopen error: %v", r.ReopenErr)
+	}
+	return s
+}
+
+// FaultTest runs a benchmark against a collection with
+// injected write faults, then reopens the database without
+// faults and checks that every acknowledged row survived.
+type FaultTest struct {
+	Id       string
+	Path     string
+	Schedule *FaultSchedule // may be nil, not supported by badger, pebble and sqlite
+	FileSize int64          // per-file size limit in bytes, 0 for none
+	Timeout  time.Duration  // how long to wait for the writer after a fault
+	Options  *CollectionOptions
+}
+
+// Run opens the collection, starts a Benchmark on it, feeds
+// it row sets with send until stop is closed by the first
+// failed write, waits for the benchmark to finish or hang,
+// and returns a report.  The benchmark hangs if a write
+// in flight makes no progress for Timeout after the last
+// write returned, or if it does not finish within Timeout
+// of its last write once the row sets are sent or a write
+// failed.
+func (ft *FaultTest) Run(send func(ch chan []*Row, stop <-chan bool) error, dur time.Duration) (report *FaultReport, err error) {
+	report = &FaultReport{Id: ft.Id, Schedule: "none"}
+	var schedule []string
+	if ft.Schedule != nil {
+		schedule = append(schedule, ft.Schedule.String())
+	}
+	if ft.FileSize > 0 {
+		schedule = append(schedule, fmt.Sprintf("fsize@%d", ft.FileSize))
+	}
+	if len(schedule) > 0 {
+		report.Schedule = strings.Join(schedule, ", ")
+	}
+
+	f := faultFile{s: ft.Schedule, size: ft.FileSize}
+	var c Collection
+	switch ft.Id {
+	case "bbolt":
+		c, err = NewFaultBBoltCollection(ft.Path, f)
+	case "bolt":
+		c, err = NewFaultBoltCollection(ft.Path, f)
+	case "kv", "kv-mu":
+		c, err = NewFaultKVCollection(ft.Path, f)
+	case "leveldb":
+		c, err = NewFaultLevelDBCollection(ft.Path, f)
+	case "badger", "pebble", "sqlite":
+		if ft.Schedule != nil {
+			return nil, fmt.Errorf("%s: write schedules are not supported, use a file size limit", ft.Id)
+		}
+		c, err = openCollection(ft.Id, ft.Path, true, ft.Options)
+	default:
+		return nil, fmt.Errorf("fault injection is not supported by %s", ft.Id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var restore func() error
+	if ft.FileSize > 0 && !contains(faultIds, ft.Id) {
+		restore, err = setFileSizeLimit(ft.FileSize)
+		if err != nil {
+			c.Close(true)
+			return nil, err
+		}
+	}
+
+	fc := newFaultCollection(c)
+	b := newBenchmark(ft.Id, ft.Path, fc)
+
+	ch := make(chan []*Row, 100)
+	b.Run(ch, dur)
+
+	// the sender stops at the first failed write, or once
+	// the writer hangs and stops taking row sets
+	stop := make(chan bool)
+	var stopOnce sync.Once
+	stopSending := func() { stopOnce.Do(func() { close(stop) }) }
+	defer stopSending()
+	go func() {
+		select {
+		case <-b.Failed():
+			stopSending()
+		case <-stop:
+		}
+	}()
+
+	sent := make(chan error, 1)
+	go func() {
+		err := send(ch, stop)
+		close(ch)
+		sent <- err
+	}()
+
+	done := make(chan bool)
+	go func() {
+		b.Wait()
+		close(done)
+	}()
+
+	tick := ft.Timeout / 10
+	if tick > time.Second {
+		tick = time.Second
+	} else if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var finishing time.Time // when the row sets were sent or a write failed
+	failed := fc.failed
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case err := <-sent:
+			if err != nil && err != io.EOF {
+				log.Println(err)
+			}
+			sent = nil
+			if finishing.IsZero() {
+				finishing = time.Now()
+			}
+		case <-failed:
+			failed = nil
+			if finishing.IsZero() {
+				finishing = time.Now()
+			}
+		case <-ticker.C:
+			last, busy := fc.progress()
+			if !busy {
+				if finishing.IsZero() {
+					continue // waiting on the sender
+				}
+				if finishing.After(last) {
+					last = finishing
+				}
+			}
+			if time.Since(last) > ft.Timeout {
+				report.Hung = true
+				stopSending()
+				break wait
+			}
+		}
+	}
+
+	fc.mu.Lock()
+	report.Err = fc.err
+	report.Acked = len(fc.acked)
+	fc.mu.Unlock()
+
+	if ft.Schedule != nil {
+		report.Faults = ft.Schedule.Faults()
+	}
+
+	if report.Hung {
+		// the writer is still blocked inside the collection,
+		// which may wait for it to close, and so to reopen
+		log.Printf("%s: writer hung, not closing or verifying the database\n", ft.Id)
+		if restore != nil {
+			err = restore()
+		}
+		return report, err
+	}
+
+	err = fc.Close(true)
+	if err != nil {
+		log.Printf("%s: close: %v", ft.Id, err)
+	}
+
+	if restore != nil {
+		if err = restore(); err != nil {
+			return report, err
+		}
+	}
+
+	ft.verify(report, fc)
+	return report, nil
+}
+
+// verify reopens the database without fault injection and
+// compares its contents against the rows acknowledged by fc.
+func (ft *FaultTest) verify(report *FaultReport, fc *faultCollection) {
+	c, err := openCollection(ft.Id, ft.Path, false, ft.Options)
+	if err != nil {
+		report.ReopenErr = err
+		return
+	}
+	defer c.Close(true)
+
+	found := make(map[string]bool, len(fc.acked))
+	for row := range c.Rows(context.Background()) {
+		if row.Err != nil {
+			report.Corrupt++
+			continue
+		}
+		report.Recovered++
+		found[string(row.Key.b)] = true
+	}
+
+	for k := range fc.acked {
+		if !found[k] {
+			report.Missing++
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// hookWriteAt replaces the writeAt hook of db, a *bolt.DB or
+// *bbolt.DB, so that its writes fail as f calls for.  The hook
+// is unexported, and is replaced the way bolt's own tests
+// replace it, so db must not be in use.
+func hookWriteAt(db interface{}, f faultFile) error {
+	v := reflect.ValueOf(db).Elem().FieldByName("ops")
+	if v.IsValid() {
+		v = v.FieldByName("writeAt")
+	}
+	hook := (func(p []byte, off int64) (n int, err error))(nil)
+	if !v.IsValid() || v.Type() != reflect.TypeOf(hook) {
+		return fmt.Errorf("unable to inject faults: %T has no writeAt hook", db)
+	}
+
+	p := (*func(p []byte, off int64) (n int, err error))(unsafe.Pointer(v.UnsafeAddr()))
+	writeAt := *p
+	*p = func(b []byte, off int64) (int, error) {
+		return f.WriteAt(writeAt, b, off)
+	}
+	return nil
+}
+
+// NewFaultBoltCollection opens a bolt database at path
+// whose page writes fail as f calls for.
+func NewFaultBoltCollection(path string, f faultFile) (c Collection, err error) {
+	if c, err = NewBoltCollection(path); err != nil {
+		return
+	}
+	if err = hookWriteAt(c.(*BoltCollection).db, f); err != nil {
+		c.Close(true)
+		return nil, err
+	}
+	return
+}
+
+// NewFaultBBoltCollection opens a bbolt database at path
+// whose page writes fail as f calls for.
+func NewFaultBBoltCollection(path string, f faultFile) (c Collection, err error) {
+	if c, err = NewBBoltCollection(path); err != nil {
+		return
+	}
+	if err = hookWriteAt(c.(*BBoltCollection).db, f); err != nil {
+		c.Close(true)
+		return nil, err
+	}
+	return
+}
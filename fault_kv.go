@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cznic/kv"
+	"github.com/cznic/lldb"
+	"os"
+)
+
+// faultFiler wraps an lldb.Filer so that its writes fail
+// as f calls for.
+type faultFiler struct {
+	lldb.Filer
+	f faultFile
+}
+
+func (ff *faultFiler) WriteAt(p []byte, off int64) (n int, err error) {
+	return ff.f.WriteAt(ff.Filer.WriteAt, p, off)
+}
+
+// NewFaultKVCollection creates a kv database at path whose
+// file writes fail as f calls for.  It is opened with the
+// options NewKVCollection uses.  kv does not add a write
+// ahead log to a filer it is given, so the faulty file is
+// wrapped in one here, as kv.Create would, and the log
+// itself is written without faults.
+func NewFaultKVCollection(path string, f faultFile) (c Collection, err error) {
+	opts := kvOptions(path)
+
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	wal, err := os.OpenFile(opts.WAL, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		fh.Close()
+		err = fmt.Errorf("unable to open %s: %v", opts.WAL, err)
+		return
+	}
+
+	filer, err := lldb.NewACIDFiler(&faultFiler{Filer: lldb.NewSimpleFileFiler(fh), f: f}, wal)
+	if err != nil {
+		fh.Close()
+		wal.Close()
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	kvdb := &KVCollection{}
+	kvdb.db, err = kv.CreateFromFiler(filer, opts)
+	if err != nil {
+		filer.Close()
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	return kvdb, err
+}
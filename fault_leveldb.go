@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// faultStorage wraps a goleveldb storage.Storage so that
+// writes to every file it creates are subject to a
+// faultFile.
+type faultStorage struct {
+	storage.Storage
+	f faultFile
+}
+
+func (fs *faultStorage) Create(fd storage.FileDesc) (w storage.Writer, err error) {
+	w, err = fs.Storage.Create(fd)
+	if err != nil {
+		return
+	}
+	return &faultWriter{Writer: w, f: fs.f}, nil
+}
+
+// faultWriter is a storage.Writer of a new file, whose
+// writes are appended at off.
+type faultWriter struct {
+	storage.Writer
+	f   faultFile
+	off int64
+}
+
+func (w *faultWriter) Write(p []byte) (n int, err error) {
+	n, err = w.f.WriteAt(func(p []byte, off int64) (int, error) {
+		return w.Writer.Write(p)
+	}, p, w.off)
+	w.off += int64(n)
+	return
+}
+
+// NewFaultLevelDBCollection opens a leveldb database at path
+// whose file writes fail as f calls for.
+func NewFaultLevelDBCollection(path string, f faultFile) (c Collection, err error) {
+	stor, err := storage.OpenFile(path, false)
+	if err != nil {
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	ldb := &LevelDBCollection{
+		cleanupFn: func() {
+			stor.Close()
+		},
+	}
+
+	ldb.db, err = leveldb.Open(&faultStorage{Storage: stor, f: f}, nil)
+	if err != nil {
+		stor.Close()
+		err = fmt.Errorf("unable to open %s: %v", path, err)
+		return
+	}
+
+	return ldb, err
+}
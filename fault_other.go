@@ -0,0 +1,12 @@
+//go:build !darwin && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"fmt"
+)
+
+func setFileSizeLimit(n int64) (restore func() error, err error) {
+	return nil, fmt.Errorf("file size limits are not supported on this platform")
+}
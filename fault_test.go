@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseFaultSchedule(t *testing.T) {
+	valid := map[string]string{
+		"enospc@0":    "enospc@0",
+		"eio@500/10":  "eio@500/10",
+		"short@12/1":  "short@12/1",
+		"enospc@1000": "enospc@1000",
+	}
+	for spec, expected := range valid {
+		s, err := ParseFaultSchedule(spec)
+		if err != nil {
+			t.Error(spec, err)
+			continue
+		}
+		if s.String() != expected {
+			t.Errorf("%s: expected %s, got %s", spec, expected, s)
+		}
+	}
+
+	for _, spec := range []string{"", "enospc", "full@10", "eio@-1", "eio@x", "eio@10/0", "eio@10/"} {
+		if _, err := ParseFaultSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestFaultScheduleWrite(t *testing.T) {
+	s, err := ParseFaultSchedule("eio@2/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	expected := []bool{false, false, true, false, false, true, false}
+	for i, fail := range expected {
+		_, err := s.Write(buf, []byte{byte(i)})
+		if fail && err != syscall.EIO {
+			t.Errorf("write %d: expected EIO, got %v", i, err)
+		}
+		if !fail && err != nil {
+			t.Errorf("write %d: unexpected error %v", i, err)
+		}
+	}
+
+	if n := s.Faults(); n != 2 {
+		t.Errorf("expected 2 faults, got %d", n)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0, 1, 3, 4, 6}) {
+		t.Errorf("unexpected bytes written: %v", buf.Bytes())
+	}
+
+	s, err = ParseFaultSchedule("short@0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	n, err := s.Write(buf, []byte{1, 2, 3, 4})
+	if n != 2 || err != io.ErrShortWrite {
+		t.Errorf("short write: expected 2, %v, got %d, %v", io.ErrShortWrite, n, err)
+	}
+}
+
+// sendTestRows sends testRows one row at a time until
+// stop is closed.
+func sendTestRows(ch chan []*Row, stop <-chan bool) error {
+	for i := range testRows {
+		select {
+		case ch <- testRows[i : i+1]:
+		case <-stop:
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestFaultFileWriteAt(t *testing.T) {
+	buf := make([]byte, 16)
+	writeAt := func(p []byte, off int64) (int, error) {
+		return copy(buf[off:], p), nil
+	}
+
+	s, err := ParseFaultSchedule("eio@1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := faultFile{s: s, size: 10}
+	for i, tc := range []struct {
+		p      []byte
+		off, n int
+		err    error
+	}{
+		{[]byte{1, 2, 3, 4, 5, 6}, 0, 6, nil},
+		{[]byte{7, 8}, 6, 0, syscall.EIO},
+		{[]byte{1, 2, 3, 4, 5, 6}, 6, 4, syscall.EFBIG},
+		{[]byte{9}, 10, 0, syscall.EFBIG},
+	} {
+		n, err := f.WriteAt(writeAt, tc.p, int64(tc.off))
+		if n != tc.n || err != tc.err {
+			t.Errorf("write %d at %d: expected %d, %v, got %d, %v", i, tc.off, tc.n, tc.err, n, err)
+		}
+	}
+	if !bytes.Equal(buf[:10], []byte{1, 2, 3, 4, 5, 6, 1, 2, 3, 4}) {
+		t.Errorf("expected writes to stop at the size limit, got %v", buf)
+	}
+}
+
+func TestFaultBolt(t *testing.T) {
+	for _, id := range []string{"bbolt", "bolt"} {
+		path, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(path)
+
+		s, err := ParseFaultSchedule("eio@20")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ft := &FaultTest{
+			Id:       id,
+			Path:     path + "/x.db",
+			Schedule: s,
+			Timeout:  time.Second,
+		}
+
+		report, err := ft.Run(sendTestRows, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Err == nil || report.Faults == 0 || report.Hung {
+			t.Errorf("%s: expected Set to fail after the injected fault: %s", id, report)
+		}
+		if report.Acked == 0 || report.ReopenErr != nil || report.Missing > 0 || report.Corrupt > 0 {
+			t.Errorf("%s: expected acknowledged rows to survive: %s", id, report)
+		}
+	}
+}
+
+func TestFaultLevelDB(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// leave enough writes for leveldb to create its
+	// manifest and journal and accept the first row set
+	s, err := ParseFaultSchedule("enospc@8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ft := &FaultTest{
+		Id:       "leveldb",
+		Path:     path,
+		Schedule: s,
+		Timeout:  100 * time.Millisecond,
+	}
+
+	report, err := ft.Run(sendTestRows, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Err == nil {
+		t.Errorf("expected Set to fail: %s", report)
+	}
+	if report.Hung {
+		t.Errorf("expected the run to stop after the failed write: %s", report)
+	}
+	if report.Faults == 0 {
+		t.Errorf("expected faults to be injected: %s", report)
+	}
+	if report.ReopenErr != nil || report.Missing > 0 || report.Corrupt > 0 {
+		t.Errorf("expected acknowledged rows to survive: %s", report)
+	}
+}
+
+func TestFaultKV(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	s, err := ParseFaultSchedule("eio@20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &FaultTest{
+		Id:       "kv",
+		Path:     path + "/x.db",
+		Schedule: s,
+		Timeout:  time.Second,
+	}
+
+	report, err := ft.Run(sendTestRows, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Err == nil || report.Faults == 0 || report.Hung {
+		t.Errorf("expected Set to fail after the injected fault: %s", report)
+	}
+	if report.Acked == 0 || report.ReopenErr != nil || report.Missing > 0 || report.Corrupt > 0 {
+		t.Errorf("expected acknowledged rows to survive: %s", report)
+	}
+}
+
+func TestFaultFileSize(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// bolt creates a 16KB file, leaving room for one more
+	// page of rows
+	ft := &FaultTest{
+		Id:       "bolt",
+		Path:     path + "/x.db",
+		FileSize: 20 << 10,
+		Timeout:  time.Second,
+	}
+
+	report, err := ft.Run(sendTestRows, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Err == nil || report.Hung {
+		t.Errorf("expected Set to fail at the size limit: %s", report)
+	}
+	if report.ReopenErr != nil || report.Missing > 0 || report.Corrupt > 0 {
+		t.Errorf("expected acknowledged rows to survive: %s", report)
+	}
+}
+
+func TestSetFileSizeLimit(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	restore, err := setFileSizeLimit(10)
+	if err != nil {
+		t.Skip(err)
+	}
+	err = ioutil.WriteFile(path+"/x", make([]byte, 16), 0666)
+	if rerr := restore(); rerr != nil {
+		t.Fatal(rerr)
+	}
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != syscall.EFBIG {
+		t.Errorf("expected a write past the limit to fail with %v, got %v", syscall.EFBIG, err)
+	}
+
+	// the restored limit allows the same write
+	if err = ioutil.WriteFile(path+"/x", make([]byte, 16), 0666); err != nil {
+		t.Errorf("expected the limit to be restored, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+// +build darwin freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"fmt"
+	"os/signal"
+	"syscall"
+)
+
+// setFileSizeLimit limits the size of any file written by
+// this process to n bytes, so that database writes past
+// that size fail with EFBIG as they would on a full disk.
+// The returned function restores the previous limit and
+// the previous handling of SIGXFSZ.
+func setFileSizeLimit(n int64) (restore func() error, err error) {
+	var old syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_FSIZE, &old)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file size limit: %v", err)
+	}
+
+	// without this the kernel kills the process with
+	// SIGXFSZ instead of failing the write
+	ignored := signal.Ignored(syscall.SIGXFSZ)
+	signal.Ignore(syscall.SIGXFSZ)
+
+	lim := syscall.Rlimit{Cur: uint64(n), Max: old.Max}
+	err = syscall.Setrlimit(syscall.RLIMIT_FSIZE, &lim)
+	if err != nil {
+		if !ignored {
+			signal.Reset(syscall.SIGXFSZ)
+		}
+		return nil, fmt.Errorf("unable to set file size limit: %v", err)
+	}
+
+	return func() error {
+		err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &old)
+		if !ignored {
+			signal.Reset(syscall.SIGXFSZ)
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the buckets of a
+// Histogram: powers of two from 1µs to about 34s.
+var histogramBounds = func() (bounds []time.Duration) {
+	for d := time.Microsecond; d <= 64*time.Second; d *= 2 {
+		bounds = append(bounds, d)
+	}
+	return
+}()
+
+// Histogram counts durations in exponentially sized
+// buckets.  It is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	counts []int64 // one per bound, plus one for larger durations
+	sum    time.Duration
+	n      int64
+}
+
+// NewHistogram returns an empty Histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, len(histogramBounds)+1)}
+}
+
+// Observe adds d to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(histogramBounds) && d > histogramBounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += d
+	h.n++
+	h.mu.Unlock()
+}
+
+// HistogramSnapshot is a copy of the counts of a Histogram.
+type HistogramSnapshot struct {
+	Counts []int64 // per bucket, not cumulative
+	Sum    time.Duration
+	Count  int64
+}
+
+// Snapshot returns a copy of the counts of h.
+func (h *Histogram) Snapshot() (s HistogramSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.Counts = append([]int64(nil), h.counts...)
+	s.Sum, s.Count = h.sum, h.n
+	return
+}
+
+// Sub returns the durations observed since prev, a snapshot
+// of the same Histogram.
+func (s HistogramSnapshot) Sub(prev HistogramSnapshot) HistogramSnapshot {
+	d := HistogramSnapshot{Counts: make([]int64, len(s.Counts)), Sum: s.Sum - prev.Sum, Count: s.Count - prev.Count}
+	for i := range s.Counts {
+		d.Counts[i] = s.Counts[i]
+		if i < len(prev.Counts) {
+			d.Counts[i] -= prev.Counts[i]
+		}
+	}
+	return d
+}
+
+// Latency summarizes the durations of a HistogramSnapshot.
+type Latency struct {
+	Count int64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// Latency returns the percentiles of the observed durations,
+// or nil if none were observed.
+func (s HistogramSnapshot) Latency() *Latency {
+	if s.Count == 0 {
+		return nil
+	}
+	return &Latency{s.Count, s.Quantile(0.5), s.Quantile(0.9), s.Quantile(0.99)}
+}
+
+// Quantile estimates the q-th quantile, 0 <= q <= 1, of the
+// observed durations by interpolating within its bucket.
+// It returns 0 when nothing has been observed.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	var seen float64
+	for i, c := range s.Counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		if i == len(histogramBounds) {
+			// unbounded: report the largest bound
+			return histogramBounds[i-1]
+		}
+		var lo time.Duration
+		if i > 0 {
+			lo = histogramBounds[i-1]
+		}
+		hi := histogramBounds[i]
+		return lo + time.Duration((rank-seen)/float64(c)*float64(hi-lo))
+	}
+	return histogramBounds[len(histogramBounds)-1]
+}
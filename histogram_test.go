@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	if q := h.Snapshot().Quantile(0.5); q != 0 {
+		t.Errorf("expected 0 for an empty histogram, got %s", q)
+	}
+
+	// 100 durations of 3µs fall in the (2µs, 4µs] bucket, and
+	// one of 10s in the (8.389s, 16.777s] bucket
+	for i := 0; i < 100; i++ {
+		h.Observe(3 * time.Microsecond)
+	}
+	h.Observe(10 * time.Second)
+
+	s := h.Snapshot()
+	if s.Count != 101 || s.Sum != 10*time.Second+300*time.Microsecond {
+		t.Errorf("expected 101 durations summing to 10.0003s, got %d summing to %s", s.Count, s.Sum)
+	}
+	if q := s.Quantile(0.5); q <= 2*time.Microsecond || q > 4*time.Microsecond {
+		t.Errorf("expected the median in (2µs, 4µs], got %s", q)
+	}
+	if q := s.Quantile(1); q <= histogramBounds[23] || q > histogramBounds[24] {
+		t.Errorf("expected the maximum in (8.389s, 16.777s], got %s", q)
+	}
+
+	h.Observe(time.Hour)
+	if q := h.Snapshot().Quantile(1); q != histogramBounds[len(histogramBounds)-1] {
+		t.Errorf("expected durations past the last bucket to report its bound, got %s", q)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// errInterrupted is returned by runs stopped by a signal.
+var errInterrupted = errors.New("interrupted")
+
+// interrupt stops runs on SIGINT or SIGTERM.  The first
+// signal closes stop, so that the run in progress stops
+// sending row sets, lets its writers finish and writes its
+// results.  A second signal force closes the collection of
+// that run and exits at once.  A nil *interrupt never stops.
+type interrupt struct {
+	stop chan bool
+	sigs chan os.Signal
+
+	mu    sync.Mutex
+	force func() error // force closes the collection of the run in progress
+}
+
+// notifyInterrupt returns an interrupt that is stopped by
+// SIGINT or SIGTERM until release is called.
+func notifyInterrupt() *interrupt {
+	i := &interrupt{stop: make(chan bool), sigs: make(chan os.Signal, 2)}
+	signal.Notify(i.sigs, os.Interrupt, syscall.SIGTERM)
+	go i.wait()
+	return i
+}
+
+func (i *interrupt) wait() {
+	sig, ok := <-i.sigs
+	if !ok {
+		return
+	}
+	log.Printf("received %s, stopping; repeat to exit at once\n", sig)
+	close(i.stop)
+
+	if sig, ok = <-i.sigs; !ok {
+		return
+	}
+	log.Printf("received %s again, closing the database and exiting\n", sig)
+	i.mu.Lock()
+	force := i.force
+	i.mu.Unlock()
+	if force != nil {
+		if err := force(); err != nil {
+			log.Println(err)
+		}
+	}
+	os.Exit(130)
+}
+
+// release stops handling signals.
+func (i *interrupt) release() {
+	if i == nil {
+		return
+	}
+	signal.Stop(i.sigs)
+	close(i.sigs)
+}
+
+// done returns a channel closed by the first signal.
+func (i *interrupt) done() <-chan bool {
+	if i == nil {
+		return nil
+	}
+	return i.stop
+}
+
+// stopped reports whether a signal has been received.
+func (i *interrupt) stopped() bool {
+	select {
+	case <-i.done():
+		return true
+	default:
+		return false
+	}
+}
+
+// setForce sets the function a second signal calls to close
+// the collection of the run in progress, or nil between runs.
+func (i *interrupt) setForce(fn func() error) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	i.force = fn
+	i.mu.Unlock()
+}
@@ -3,165 +3,219 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"runtime"
-	"time"
+	"strings"
 )
 
 var usage = `USAGE:
 
+kvbench COMMAND OPTIONS
 kvbench OPTIONS
 
-DETAILS:
-
-Running a benchmark consists of two steps:
-
-(1) Generate a sample data file using the -o option.
-    Use the -n, -b[01], -k[01], and -v[01] options to control the
-    size of the sample.  Use the -r <seed> option to change the
-    pseudo-random data.  Given identical inputs, an identical data
-    file should be generated.
-
-(2) Consume a sample data file and execute a benchmark using the
-    -i option.  Or use both -o and -i options to generate the data
-    and then run the benchmark.  Use the -d[01] options to control
-    the inter-arrival rate of new row sets to be written to the
-    collection.  The -p option controls how often the benchmark
-    will attempt to iterate over the keys.
-
-OUTPUT OPTIONS
-
--r n - pseudo-random seed
--n n - total number of blocks to generate
-
--b0 min - minimum number of records per block
--b1 max - maximum number of records per block
+COMMANDS:
 
--k0 min - minimum length of key to generate
--k1 max - maximum length of key to generate
+generate - generate a sample data file
+run      - replay a data file into a database while polling it
+verify   - check that a database holds exactly the rows of a data file
+inspect  - summarize a data file or a database
+compare  - compare the results files of two or more runs
+report   - write an HTML report with charts of results files
+serve    - serve a database to runs in another process
 
--v0 min - minium length of value to generate
--v1 max - maximum length of value to generate
+Use kvbench COMMAND -h to list the options of each command.
 
--o dat - output path for data file
-
-INPUT OPTIONS
+DETAILS:
 
--r n    - pseudo-random seed
--d0 dur - minimum inter-arrival rate
--d1 dur - maximum inter-arrival rate (not guaranteed)
--p dur  - poll db at this interval and print statistics
+Running a benchmark consists of two steps:
 
--i dat   - input path for data file
--b bench - name of the benchmark to run (bolt, kv, leveldb, noop)
--f path  - path to the database
+(1) Generate a sample data file with kvbench generate.  Given
+    identical options, an identical data file is generated.
+
+(2) Consume the sample data file and execute a benchmark with
+    kvbench run.  Row sets from the file are written to the
+    collection at a randomized inter-arrival rate while the
+    benchmark periodically iterates over the keys and reports how
+    long that took, along with the disk, CPU, memory and internal
+    statistics of the collection.  Use the -results option to
+    save these measurements, kvbench compare to compare them
+    across runs, and kvbench report to chart them.
+
+COMPATIBILITY
+
+Options given without a command are accepted as in earlier
+releases: -o dat generates a data file using the generate options,
+-i dat runs a benchmark using the run options, and both together do
+both.  Generate options are ignored when -o is not given, so prefer
+the commands, which reject options that do not apply.
 `
-var help bool
-
-var seed int64
-
-var blocks int
-var b0 int
-var b1 int
-var k0 int
-var k1 int
-var v0 int
-var v1 int
-var outputDat string
-
-var d0 time.Duration
-var d1 time.Duration
-var p time.Duration
-var benchmarkId string
-var databasePath string
-var inputDat string
 
-func main() {
-	flag.BoolVar(&help, "h", false, "print usage")
-
-	flag.Int64Var(&seed, "r", 0, "pseudo random seed")
-
-	flag.IntVar(&blocks, "n", 200, "number of record blocks")
-	flag.IntVar(&b0, "b0", 1, "minimum number of records per block")
-	flag.IntVar(&b1, "b1", 1000, "maximum number of records per block")
-	flag.IntVar(&k0, "k0", 32, "minimum number of bytes in a key")
-	flag.IntVar(&k1, "k1", 32, "maximum number of bytes in a key")
-	flag.IntVar(&v0, "v0", 512, "minimum number of bytes in a value")
-	flag.IntVar(&v1, "v1", 1024, "maximum number of bytes in a value")
-	flag.StringVar(&outputDat, "o", "", "output path for data")
+// usageError is returned by commands when their
+// arguments are invalid.
+type usageError struct {
+	error
+}
 
-	flag.DurationVar(&d0, "d0", 500*time.Millisecond, "minimum inter-arrival rate")
-	flag.DurationVar(&d1, "d1", time.Second, "maximum inter-arrival rate (not guaranteed)")
-	flag.DurationVar(&p, "p", 10*time.Second, "poll db at this interval and print statistics")
-	flag.StringVar(&benchmarkId, "b", "", "benchmark id: leveldb, kv, kv-mu, bolt")
-	flag.StringVar(&databasePath, "f", "", "database path")
-	flag.StringVar(&inputDat, "i", "", "input path for data")
+// command is a kvbench subcommand.
+type command struct {
+	name string
+	run  func(args []string) error
+}
 
-	flag.Parse()
+var commands = []command{
+	{"generate", generateCommand},
+	{"run", runCommand},
+	{"verify", verifyCommand},
+	{"inspect", inspectCommand},
+	{"compare", compareCommand},
+	{"report", reportCommand},
+	{"serve", serveCommand},
+}
 
-	if help {
-		fmt.Println(usage)
-		return
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	rnd := NewRandom(seed)
+	name, args := os.Args[1], os.Args[2:]
+	if strings.HasPrefix(name, "-") {
+		name, args = "", os.Args[1:]
+	}
 
-	if outputDat != "" {
-		fh, err := os.Create(outputDat)
-		if err != nil {
-			log.Fatal(err)
+	var run func(args []string) error
+	switch name {
+	case "":
+		run = legacyCommand
+	case "help":
+		fmt.Println(usage)
+		return
+	default:
+		for _, cmd := range commands {
+			if cmd.name == name {
+				run = cmd.run
+			}
 		}
+	}
+	if run == nil {
+		fmt.Fprintf(os.Stderr, "kvbench: unknown command %q\n\n%s\n", name, usage)
+		os.Exit(2)
+	}
 
-		log.Printf("writing data to %s\n", outputDat)
-		err = rnd.Write(fh, blocks, b0, b1, k0, k1, v0, v1)
-		if err != nil {
-			log.Fatal(err)
+	err := run(args)
+	if err == nil {
+		return
+	}
+	if _, ok := err.(usageError); ok {
+		if name == "" {
+			fmt.Fprintf(os.Stderr, "kvbench: %v\nRun 'kvbench -h' for usage.\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "kvbench %s: %v\nRun 'kvbench %s -h' for usage.\n", name, err, name)
 		}
+		os.Exit(2)
+	}
+	log.Println(err)
+	if err == errInterrupted {
+		os.Exit(130)
+	}
+	os.Exit(1)
+}
 
-		fh.Close()
+// newFlagSet returns a FlagSet for the named command that
+// prints usage when given -h or an undefined flag.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
 	}
+	return fs
+}
 
-	if inputDat != "" {
-		if benchmarkId == "" {
-			fmt.Println("missing required -b <benchmarkId> argument")
-			return
-		}
-		if databasePath == "" {
-			fmt.Println("missing required -f <database> argument")
-			return
-		}
+// parseFlags parses args with fs, rejecting any
+// positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return usageError{fmt.Errorf("unexpected argument %q", fs.Arg(0))}
+	}
+	return nil
+}
 
-		benchmark, err := NewBenchmark(benchmarkId, databasePath)
-		if err != nil {
-			log.Println(err)
-			return
-		}
+// sqliteFlags registers the sqlite collection options,
+// to be parsed into o.
+func sqliteFlags(fs *flag.FlagSet, o *SQLiteOptions) {
+	fs.StringVar(&o.Journal, "sqlite-journal", defaultSQLiteOptions.Journal, "sqlite journal mode")
+	fs.StringVar(&o.Synchronous, "sqlite-sync", defaultSQLiteOptions.Synchronous, "sqlite synchronous level")
+}
 
-		fh, err := os.Open(inputDat)
-		if err != nil {
-			log.Fatal(err)
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
+	}
+	return false
+}
 
-		defer fh.Close()
-
-		ch := make(chan []*Row, 100)
-
-		benchmark.Run(ch, p)
+// legacyCommand implements the single flag set accepted
+// before kvbench had commands.
+func legacyCommand(args []string) (err error) {
+	gen := &generateConfig{}
+	run := &runConfig{}
+
+	fs := newFlagSet("kvbench", usage)
+	fs.Int64Var(&gen.seed, "r", 0, "pseudo random seed")
+	gen.flags(fs)
+	run.flags(fs)
+	if err = parseFlags(fs, args); err != nil {
+		return
+	}
+	run.seed = gen.seed
+	run.options = flagValues(fs.VisitAll)
 
-		log.Printf("reading data from %s\n", inputDat)
-		err = rnd.Send(ch, fh, d0, d1)
-		if err != nil {
-			if err != io.EOF {
-				log.Println(err)
+	if gen.output == "" {
+		fs.Visit(func(f *flag.Flag) {
+			if gen.owns(f.Name) {
+				log.Printf("warning: -%s is ignored without -o, use kvbench generate\n", f.Name)
 			}
+		})
+	}
+	if run.input == "" {
+		fs.Visit(func(f *flag.Flag) {
+			if run.owns(f.Name) {
+				log.Printf("warning: -%s is ignored without -i, use kvbench run\n", f.Name)
+			}
+		})
+	}
+
+	if gen.output != "" {
+		if err = gen.validate(); err != nil {
+			return usageError{err}
+		}
+	}
+	if run.input != "" {
+		if err = run.validate(); err != nil {
+			return usageError{err}
 		}
+	}
 
-		close(ch)
+	// the run draws its inter-arrival times from its own
+	// stream of the seed, so they are the same whether or
+	// not the data file is generated first
+	if gen.output != "" {
+		if err = gen.generate(NewRandom(gen.seed)); err != nil {
+			return
+		}
+	}
 
-		benchmark.Wait()
+	if run.input != "" {
+		run.stop = notifyInterrupt()
+		defer run.stop.release()
+		_, err = run.run()
 	}
+	return
 }
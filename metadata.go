@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Metadata describes the machine, build, options and data
+// file of a run, so that results from different hosts and
+// builds can be told apart.
+type Metadata struct {
+	Hostname   string
+	CPU        string // model name, if known
+	CPUs       int
+	Kernel     string // kernel release, if known
+	OS         string
+	Arch       string
+	Filesystem string // type of the filesystem holding the database, if known
+	GoVersion  string
+	GOMAXPROCS int
+	Commit     string            `json:",omitempty"` // revision kvbench was built from
+	Modified   bool              `json:",omitempty"` // built with uncommitted changes
+	Modules    map[string]string `json:",omitempty"` // version of each dependency
+	Args       []string          // command line
+	Options    map[string]string // run options, including defaults
+	Data       *DataFile         `json:",omitempty"`
+}
+
+// DataFile identifies the data file replayed by a run.
+type DataFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	SHA256  string
+}
+
+// meta returns the metadata of the run, or an empty
+// Metadata for results written before it was recorded.
+func (r *Results) meta() *Metadata {
+	if r.Metadata == nil {
+		return &Metadata{}
+	}
+	return r.Metadata
+}
+
+// dataDigest returns a prefix of the digest of the data
+// file, enough to tell data files apart.
+func (m *Metadata) dataDigest() string {
+	if m.Data == nil || len(m.Data.SHA256) < 12 {
+		return ""
+	}
+	return m.Data.SHA256[:12]
+}
+
+// CollectMetadata describes the current process and host,
+// and the filesystem holding path.
+func CollectMetadata(path string) *Metadata {
+	m := &Metadata{
+		CPUs:       runtime.NumCPU(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		GoVersion:  runtime.Version(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Args:       os.Args,
+	}
+	m.Hostname, _ = os.Hostname()
+	m.CPU = cpuModel()
+	if b, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		m.Kernel = strings.TrimSpace(string(b))
+	}
+	if path != "" {
+		m.Filesystem = filesystemType(existingParent(path))
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		m.Modules = make(map[string]string, len(bi.Deps))
+		for _, dep := range bi.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			m.Modules[dep.Path] = dep.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				m.Commit = s.Value
+			case "vcs.modified":
+				m.Modified = s.Value == "true"
+			}
+		}
+	}
+	return m
+}
+
+// cpuModel returns the model name of the first CPU listed
+// in /proc/cpuinfo, or "" if it is unavailable.
+func cpuModel() string {
+	fh, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer fh.Close()
+
+	s := bufio.NewScanner(fh)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "model name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// existingParent returns path, or its nearest parent that
+// exists, since the database may not have been created yet.
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// ReadDataFile returns the size, modification time and
+// SHA-256 digest of the data file at path.
+func ReadDataFile(path string) (d *DataFile, err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, fh); err != nil {
+		return
+	}
+	return &DataFile{
+		Path:    path,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// filesystemTypes names the statfs magic numbers of
+// common Linux filesystems.
+var filesystemTypes = map[int64]string{
+	0xef53:     "ext4", // also ext2 and ext3
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0xf2f52010: "f2fs",
+	0x01021994: "tmpfs",
+	0x794c7630: "overlayfs",
+	0x6969:     "nfs",
+	0x65735546: "fuse",
+	0x4d44:     "vfat",
+	0x5346544e: "ntfs",
+}
+
+// filesystemType returns the type of the filesystem
+// holding path, or "" if it cannot be determined.
+func filesystemType(path string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return ""
+	}
+	if name, ok := filesystemTypes[int64(st.Type)]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", st.Type)
+}
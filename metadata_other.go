@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// filesystemType is only implemented on Linux.
+func filesystemType(path string) string {
+	return ""
+}
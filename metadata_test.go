@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCollectMetadata(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// the database need not exist yet
+	m := CollectMetadata(filepath.Join(path, "db", "x.db"))
+	if m.Hostname == "" || m.CPUs < 1 || m.GoVersion != runtime.Version() || m.GOMAXPROCS < 1 || len(m.Args) == 0 {
+		t.Errorf("expected the host and process to be described, got %+v", m)
+	}
+	if runtime.GOOS == "linux" && (m.Kernel == "" || m.Filesystem == "") {
+		t.Errorf("expected the kernel and filesystem to be known on linux, got %+v", m)
+	}
+
+	file := filepath.Join(path, "x.dat")
+	if err = ioutil.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadDataFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Size != 3 || d.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("unexpected data file description %+v", d)
+	}
+	m.Data = d
+	if m.dataDigest() != "ba7816bf8f01" {
+		t.Errorf("unexpected digest %s", m.dataDigest())
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics serves the counters of the running benchmark over
+// HTTP at /metrics, in the Prometheus text format or, when the
+// scraper asks for it, in the OpenMetrics format.  Between
+// runs no benchmark metrics are served.
+type Metrics struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	b        *Benchmark
+	scenario string
+}
+
+// ListenMetrics returns Metrics served at addr.
+func ListenMetrics(addr string) (m *Metrics, err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %v", addr, err)
+	}
+	m = &Metrics{l: l}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go http.Serve(l, mux) // returns once Close is called
+	log.Printf("serving metrics at http://%s/metrics\n", l.Addr())
+	return m, nil
+}
+
+// Addr returns the address the metrics are served at.
+func (m *Metrics) Addr() net.Addr {
+	return m.l.Addr()
+}
+
+// Close stops serving the metrics.
+func (m *Metrics) Close() error {
+	return m.l.Close()
+}
+
+// Set serves the metrics of b, labeled with the name of
+// the scenario it runs, if any, until Set is called again.
+// b may be nil between runs.
+func (m *Metrics) Set(b *Benchmark, scenario string) {
+	m.mu.Lock()
+	m.b, m.scenario = b, scenario
+	m.mu.Unlock()
+}
+
+const (
+	prometheusType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	open := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if open {
+		w.Header().Set("Content-Type", openMetricsType)
+	} else {
+		w.Header().Set("Content-Type", prometheusType)
+	}
+	bw := bufio.NewWriter(w)
+	m.write(bw, open)
+	bw.Flush()
+}
+
+// write writes the metrics of the current benchmark to w.
+func (m *Metrics) write(w io.Writer, open bool) {
+	m.mu.Lock()
+	b, scenario := m.b, m.scenario
+	m.mu.Unlock()
+
+	mw := &metricsWriter{w: w, open: open}
+	if b != nil {
+		mw.labels = fmt.Sprintf(`backend="%s",scenario="%s"`, escapeLabel(b.id), escapeLabel(scenario))
+		writeBenchmarkMetrics(mw, b.Live())
+	}
+	if open {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+func writeBenchmarkMetrics(mw *metricsWriter, s LiveSample) {
+	mw.counter("kvbench_row_sets_arrived_total", "Row sets taken from the queue by a writer.", float64(s.Arrived))
+	mw.counter("kvbench_row_sets_written_total", "Row sets written to the collection.", float64(s.RowSets))
+	mw.counter("kvbench_rows_written_total", "Rows written to the collection.", float64(s.Rows))
+	mw.gauge("kvbench_queue_depth", "Row sets waiting for a writer.", float64(s.Backlog))
+	mw.histogram("kvbench_set_duration_seconds", "Time to write each row set.", s.SetLatency)
+
+	mw.counter("kvbench_scans_total", "Scans of the collection completed.", float64(s.Scans))
+	mw.counter("kvbench_rows_scanned_total", "Rows visited by scans.", float64(s.Scanned))
+	mw.counter("kvbench_scan_timeouts_total", "Scans stopped by the scan timeout.", float64(s.Timeouts))
+	mw.histogram("kvbench_scan_duration_seconds", "Time of each scan.", s.ScanLatency)
+
+	if d := s.Disk; d != nil {
+		mw.gauge("kvbench_disk_bytes", "Bytes on disk at the last poll.", float64(d.Bytes))
+		mw.gauge("kvbench_disk_files", "Files on disk at the last poll.", float64(d.Files))
+		mw.gauge("kvbench_space_amplification", "Bytes on disk per live byte at the last poll.", d.SpaceAmp())
+		if d.Written >= 0 {
+			mw.gauge("kvbench_write_amplification", "Bytes written to disk per logical byte at the last poll.", d.WriteAmp())
+		}
+	}
+
+	r := s.Resources
+	mw.gauge("kvbench_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(r.HeapAlloc))
+	mw.gauge("kvbench_heap_sys_bytes", "Bytes of heap memory obtained from the OS.", float64(r.HeapSys))
+	if r.RSS >= 0 {
+		mw.gauge("kvbench_rss_bytes", "Resident set size of the process.", float64(r.RSS))
+	}
+	mw.counter("kvbench_gc_cycles_total", "Completed GC cycles.", float64(r.NumGC))
+	mw.counter("kvbench_gc_pause_seconds_total", "GC stop-the-world pause time.", r.PauseTotal.Seconds())
+
+	keys := make([]string, 0, len(s.Stats))
+	for k := range s.Stats {
+		if _, ok := statValue(s.Stats[k]); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		mw.family("kvbench_backend_stat", "gauge", "Numeric statistics reported by the collection at the last poll, durations in seconds.")
+		for _, k := range keys {
+			v, _ := statValue(s.Stats[k])
+			mw.sample("kvbench_backend_stat", fmt.Sprintf(`stat="%s"`, escapeLabel(k)), v)
+		}
+	}
+}
+
+// statValue returns the numeric value of a collection stat.
+func statValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case time.Duration:
+		return v.Seconds(), true
+	}
+	return 0, false
+}
+
+// metricsWriter writes metric families in the Prometheus
+// text format, or the OpenMetrics format if open is true.
+type metricsWriter struct {
+	w      io.Writer
+	open   bool
+	labels string // labels of every sample
+}
+
+// family writes the metadata of a metric family.  OpenMetrics
+// names counter families without their _total suffix.
+func (mw *metricsWriter) family(name, typ, help string) {
+	if mw.open && typ == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample, with extra labels if not empty.
+func (mw *metricsWriter) sample(name, extra string, v float64) {
+	labels := mw.labels
+	if extra != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += extra
+	}
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(mw.w, "%s %s\n", name, formatMetric(v))
+}
+
+func (mw *metricsWriter) counter(name, help string, v float64) {
+	mw.family(name, "counter", help)
+	mw.sample(name, "", v)
+}
+
+func (mw *metricsWriter) gauge(name, help string, v float64) {
+	mw.family(name, "gauge", help)
+	mw.sample(name, "", v)
+}
+
+// histogram writes h with cumulative buckets in seconds.
+func (mw *metricsWriter) histogram(name, help string, h HistogramSnapshot) {
+	mw.family(name, "histogram", help)
+	var n int64
+	for i, c := range h.Counts {
+		n += c
+		le := "+Inf"
+		if i < len(histogramBounds) {
+			le = formatMetric(histogramBounds[i].Seconds())
+		}
+		mw.sample(name+"_bucket", fmt.Sprintf(`le="%s"`, le), float64(n))
+	}
+	mw.sample(name+"_sum", "", h.Sum.Seconds())
+	mw.sample(name+"_count", "", float64(h.Count))
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the text formats.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m, err := ListenMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	scrape := func(accept string) (string, string) {
+		req, err := http.NewRequest("GET", "http://"+m.Addr().String()+"/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b), resp.Header.Get("Content-Type")
+	}
+
+	if body, _ := scrape(""); body != "" {
+		t.Errorf("expected no metrics before a run, got:\n%s", body)
+	}
+
+	c, err := NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBenchmark("map", "", c)
+	m.Set(b, `soak "1"`)
+
+	buf := &bytes.Buffer{}
+	if err := NewRandom(3).Write(buf, 20, 1, 10, 4, 8, 4, 8); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []*Row, 100)
+	b.Run(ch, time.Millisecond)
+	NewRandom(3).Send(ch, buf, 0, 0)
+	close(ch)
+	b.Wait()
+
+	body, typ := scrape("")
+	if !strings.HasPrefix(typ, "text/plain") {
+		t.Errorf("expected the Prometheus text format, got %s", typ)
+	}
+	labels := `backend="map",scenario="soak \"1\""`
+	for _, want := range []string{
+		"# TYPE kvbench_row_sets_written_total counter\n",
+		"kvbench_row_sets_written_total{" + labels + "} 20\n",
+		"kvbench_queue_depth{" + labels + "} 0\n",
+		"# TYPE kvbench_set_duration_seconds histogram\n",
+		"kvbench_set_duration_seconds_bucket{" + labels + `,le="+Inf"} 20` + "\n",
+		"kvbench_set_duration_seconds_count{" + labels + "} 20\n",
+		"kvbench_backend_stat{" + labels + `,stat="rows"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "# EOF") {
+		t.Errorf("expected no EOF marker in the Prometheus text format")
+	}
+
+	body, typ = scrape("application/openmetrics-text; version=1.0.0")
+	if !strings.HasPrefix(typ, "application/openmetrics-text") {
+		t.Errorf("expected the OpenMetrics format, got %s", typ)
+	}
+	for _, want := range []string{
+		"# TYPE kvbench_row_sets_written counter\n",
+		"kvbench_row_sets_written_total{" + labels + "} 20\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("expected the OpenMetrics EOF marker")
+	}
+
+	m.Set(nil, "")
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no metrics between runs, got:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+func init() {
+	// Stats values travel as interface{}
+	gob.Register(time.Duration(0))
+	gob.Register(uint64(0))
+}
+
+// remoteScanIdle is how long an open scan waits for the
+// client to fetch its next page before it is abandoned,
+// releasing the read transaction or lock it holds.
+const remoteScanIdle = 30 * time.Second
+
+// errScanIdle stops a scan whose client stopped fetching
+// pages.
+var errScanIdle = errors.New("scan idle")
+
+// RemoteRows is the argument to CollectionService.Set.
+type RemoteRows struct {
+	Keys   [][]byte
+	Values [][]byte
+}
+
+// RemoteValue is the reply to CollectionService.Get.
+type RemoteValue struct {
+	Value []byte
+	Found bool
+}
+
+// ScanArgs is the argument to CollectionService.ScanNext.
+type ScanArgs struct {
+	Id    int64
+	Limit int
+}
+
+// ScanReply is the reply to CollectionService.ScanNext.
+// Done is set on the last page of a scan.
+type ScanReply struct {
+	Keys   [][]byte
+	Values [][]byte
+	Done   bool
+}
+
+// CollectionService exposes a Collection over net/rpc so
+// that it can be benchmarked from a separate process.  One
+// is created per connection, so that the scans left open
+// by a client are closed when it goes away.
+type CollectionService struct {
+	c     Collection
+	mu    sync.Mutex
+	next  int64
+	scans map[int64]*scanCursor
+}
+
+// scanCursor is an open scan, fed by a goroutine running
+// ForEach over the collection.
+type scanCursor struct {
+	ch     chan [2][]byte
+	cancel context.CancelFunc
+	err    error // set before ch is closed
+}
+
+func NewCollectionService(c Collection) *CollectionService {
+	return &CollectionService{
+		c:     c,
+		scans: make(map[int64]*scanCursor),
+	}
+}
+
+func (s *CollectionService) Set(args RemoteRows, reply *struct{}) error {
+	rows := make([]*Row, len(args.Keys))
+	for i := range args.Keys {
+		rows[i] = &Row{
+			Key:   RowKey{b: args.Keys[i]},
+			Value: &RowValue{b: args.Values[i]},
+		}
+	}
+	return s.c.Set(context.Background(), rows)
+}
+
+func (s *CollectionService) Delete(key []byte, reply *struct{}) error {
+	return s.c.Delete(context.Background(), RowKey{b: key})
+}
+
+// Get looks up a single key.
+func (s *CollectionService) Get(key []byte, reply *RemoteValue) (err error) {
+	reply.Value, reply.Found, err = getValue(context.Background(), s.c, key)
+	return
+}
+
+// ScanOpen starts a scan of the collection in key order,
+// returning an id to pass to ScanNext.  The scan is
+// abandoned if ScanNext is not called for remoteScanIdle.
+func (s *CollectionService) ScanOpen(args struct{}, id *int64) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cur := &scanCursor{
+		ch:     make(chan [2][]byte, 1024),
+		cancel: cancel,
+	}
+
+	s.mu.Lock()
+	s.next++
+	*id = s.next
+	s.scans[*id] = cur
+	s.mu.Unlock()
+
+	go func(id int64) {
+		idle := time.NewTimer(remoteScanIdle)
+		defer idle.Stop()
+
+		cur.err = s.c.ForEach(ctx, func(k, v []byte) error {
+			kv := [2][]byte{append([]byte(nil), k...), append([]byte(nil), v...)}
+			select {
+			case cur.ch <- kv:
+				return nil
+			default:
+			}
+
+			// the page is full, wait for the next ScanNext
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(remoteScanIdle)
+			select {
+			case cur.ch <- kv:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-idle.C:
+				return errScanIdle
+			}
+		})
+		close(cur.ch)
+
+		if cur.err == errScanIdle {
+			s.closeScan(id)
+		}
+	}(*id)
+
+	return nil
+}
+
+// ScanNext returns up to args.Limit rows from an open scan.
+// The scan is closed once the last page is returned.
+func (s *CollectionService) ScanNext(args ScanArgs, reply *ScanReply) error {
+	s.mu.Lock()
+	cur, ok := s.scans[args.Id]
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("unknown, closed or idle scan id")
+	}
+
+	for len(reply.Keys) < args.Limit {
+		kv, ok := <-cur.ch
+		if !ok {
+			reply.Done = true
+			s.mu.Lock()
+			delete(s.scans, args.Id)
+			s.mu.Unlock()
+			return cur.err
+		}
+		reply.Keys = append(reply.Keys, kv[0])
+		reply.Values = append(reply.Values, kv[1])
+	}
+	return nil
+}
+
+// ScanClose abandons an open scan.
+func (s *CollectionService) ScanClose(id int64, reply *struct{}) error {
+	s.closeScan(id)
+	return nil
+}
+
+func (s *CollectionService) closeScan(id int64) {
+	s.mu.Lock()
+	cur, ok := s.scans[id]
+	delete(s.scans, id)
+	s.mu.Unlock()
+	if ok {
+		cur.cancel()
+	}
+}
+
+// closeScans abandons every open scan.
+func (s *CollectionService) closeScans() {
+	s.mu.Lock()
+	scans := s.scans
+	s.scans = make(map[int64]*scanCursor)
+	s.mu.Unlock()
+	for _, cur := range scans {
+		cur.cancel()
+	}
+}
+
+// Stats returns the statistics of the collection, if it
+// keeps any, and the resource usage of the serving process
+// prefixed with server_, so that polls of a remote
+// collection report the memory and GC of the store rather
+// than of the load generator.
+func (s *CollectionService) Stats(args struct{}, reply *map[string]interface{}) error {
+	m := make(map[string]interface{})
+	if sc, ok := s.c.(StatsCollection); ok {
+		m = sc.Stats()
+	}
+
+	r := SampleResources()
+	if r.User >= 0 {
+		m["server_user"] = r.User
+		m["server_sys"] = r.Sys
+	}
+	if r.RSS >= 0 {
+		m["server_rss"] = r.RSS
+	}
+	m["server_heap_alloc"] = r.HeapAlloc
+	m["server_heap_sys"] = r.HeapSys
+	m["server_total_alloc"] = r.TotalAlloc
+	m["server_mallocs"] = r.Mallocs
+	m["server_num_gc"] = uint64(r.NumGC)
+	m["server_gc_pause"] = r.PauseTotal
+
+	*reply = m
+	return nil
+}
+
+// ServeCollection serves c over net/rpc on HTTP connections
+// accepted from l until l is closed.
+func ServeCollection(l net.Listener, c Collection) error {
+	return http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		serveCollectionConn(w, req, c)
+	}))
+}
+
+// serveCollectionConn serves c on the connection of req,
+// as rpc.Server.ServeHTTP does, with a CollectionService
+// of its own whose scans are closed once the client hangs
+// up.
+func serveCollectionConn(w http.ResponseWriter, req *http.Request, c Collection) {
+	if req.Method != "CONNECT" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	io.WriteString(conn, "HTTP/1.0 200 Connected to Go RPC\n\n")
+
+	s := NewCollectionService(c)
+	defer s.closeScans()
+
+	srv := rpc.NewServer()
+	if err = srv.RegisterName("Collection", s); err != nil {
+		conn.Close()
+		return
+	}
+	srv.ServeConn(conn)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestCollectionRemote(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	served, err := NewBTreeCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeCollection(l, served)
+
+	c, err := NewRemoteCollection(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "remote", c)
+
+	err = c.Set(context.Background(), testRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := c.(*RemoteCollection)
+	v, found, err := rc.Get(context.Background(), testRows[7].Key.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || string(v) != string(testRows[7].Value.b) {
+		t.Errorf("Get returned %v, expected %v", v, testRows[7].Value.b)
+	}
+	v, found, err = rc.Get(context.Background(), []byte("missing"))
+	if err != nil || found {
+		t.Errorf("Get of a missing key returned %v, %v, %v", v, found, err)
+	}
+
+	// abandon scans part way through, more than a page in
+	many := make([]*Row, 0, 3*remoteScanPage)
+	for i := 0; i < cap(many); i++ {
+		many = append(many, &Row{
+			Key:   RowKey{b: []byte{byte(i >> 8), byte(i), 0}},
+			Value: &RowValue{b: []byte{byte(i)}},
+		})
+	}
+	err = c.Set(context.Background(), many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	for _, at := range []int{1, remoteScanPage + 1} {
+		n := 0
+		err = c.ForEach(context.Background(), func(k, v []byte) error {
+			n++
+			if n == at {
+				return stop
+			}
+			return nil
+		})
+		if err != stop {
+			t.Errorf("expected ForEach to stop after %d rows, got %v", at, err)
+		}
+	}
+
+	stats := rc.Stats()
+	if stats["rows"] != len(testRows)+len(many) {
+		t.Errorf("unexpected remote stats: %v", stats)
+	}
+	if _, ok := stats["server_heap_alloc"]; !ok {
+		t.Errorf("expected the server's resource usage in the remote stats: %v", stats)
+	}
+
+	err = c.Close(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteScanClosedWithConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a skiplist scan holds the read lock, blocking Set,
+	// until the scan ends
+	served, err := NewSkiplistCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := make([]*Row, 0, 3*remoteScanPage)
+	for i := 0; i < cap(many); i++ {
+		many = append(many, &Row{
+			Key:   RowKey{b: []byte{byte(i >> 8), byte(i)}},
+			Value: &RowValue{b: []byte{byte(i)}},
+		})
+	}
+	if err = served.Set(context.Background(), many); err != nil {
+		t.Fatal(err)
+	}
+	go ServeCollection(l, served)
+
+	client, err := rpc.DialHTTP("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err = client.Call("Collection.ScanOpen", struct{}{}, &id); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- served.Set(context.Background(), testRows) }()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scan of a closed connection still holds its lock")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the USER_HZ used by /proc/[pid]/stat
+// to report CPU times, which is 100 on all Linux
+// platforms Go supports.
+const clockTicks = 100
+
+// ResourceSample records the CPU, memory and garbage
+// collector usage of the process at one point in time,
+// or, when returned by Sub, over an interval.
+type ResourceSample struct {
+	User       time.Duration // user CPU time, -1 if unknown
+	Sys        time.Duration // system CPU time, -1 if unknown
+	RSS        int64         // resident set size in bytes, -1 if unknown
+	HeapAlloc  uint64        // bytes of allocated heap objects
+	HeapSys    uint64        // bytes of heap memory obtained from the OS
+	TotalAlloc uint64        // cumulative bytes allocated
+	Mallocs    uint64        // cumulative heap objects allocated
+	NumGC      uint32        // completed GC cycles
+	PauseTotal time.Duration // cumulative GC stop-the-world pause time
+}
+
+// SampleResources returns the current resource usage
+// of the process.
+func SampleResources() ResourceSample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return sampleResources(&m)
+}
+
+func sampleResources(m *runtime.MemStats) (s ResourceSample) {
+	s.User, s.Sys = -1, -1
+	if b, err := ioutil.ReadFile("/proc/self/stat"); err == nil {
+		if user, sys, err := parseProcStat(string(b)); err == nil {
+			s.User, s.Sys = user, sys
+		}
+	}
+
+	s.RSS = -1
+	if b, err := ioutil.ReadFile("/proc/self/statm"); err == nil {
+		if rss, err := parseProcStatm(string(b)); err == nil {
+			s.RSS = rss * int64(os.Getpagesize())
+		}
+	}
+
+	s.HeapAlloc = m.HeapAlloc
+	s.HeapSys = m.HeapSys
+	s.TotalAlloc = m.TotalAlloc
+	s.Mallocs = m.Mallocs
+	s.NumGC = m.NumGC
+	s.PauseTotal = time.Duration(m.PauseTotalNs)
+	return
+}
+
+// Sub returns the usage between prev and s.  Cumulative
+// counters are subtracted while RSS and heap sizes are
+// taken from s.
+func (s ResourceSample) Sub(prev ResourceSample) ResourceSample {
+	d := s
+	if s.User >= 0 && prev.User >= 0 {
+		d.User = s.User - prev.User
+		d.Sys = s.Sys - prev.Sys
+	} else {
+		d.User, d.Sys = -1, -1
+	}
+	d.TotalAlloc = s.TotalAlloc - prev.TotalAlloc
+	d.Mallocs = s.Mallocs - prev.Mallocs
+	d.NumGC = s.NumGC - prev.NumGC
+	d.PauseTotal = s.PauseTotal - prev.PauseTotal
+	return d
+}
+
+func (s ResourceSample) String() string {
+	cpu := "cpu n/a"
+	if s.User >= 0 {
+		cpu = fmt.Sprintf("cpu %s user %s sys", s.User, s.Sys)
+	}
+	rss := "rss n/a"
+	if s.RSS >= 0 {
+		rss = fmt.Sprintf("rss %d bytes", s.RSS)
+	}
+	return fmt.Sprintf("%s, %s, heap %d/%d bytes, %d gc (%s paused), %d allocs (%d bytes)",
+		cpu, rss, s.HeapAlloc, s.HeapSys, s.NumGC, s.PauseTotal, s.Mallocs, s.TotalAlloc)
+}
+
+// parseProcStat returns the user and system CPU time
+// from the contents of /proc/[pid]/stat.
+func parseProcStat(stat string) (user, sys time.Duration, err error) {
+	// the command name may contain spaces, so
+	// start counting fields after its closing paren
+	i := strings.LastIndex(stat, ")")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("malformed stat: %q", stat)
+	}
+
+	// utime and stime are fields 14 and 15, the
+	// first field after the paren is field 3
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("malformed stat: %q", stat)
+	}
+
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return
+	}
+
+	user = time.Duration(utime) * time.Second / clockTicks
+	sys = time.Duration(stime) * time.Second / clockTicks
+	return
+}
+
+// parseProcStatm returns the resident set size in pages
+// from the contents of /proc/[pid]/statm.
+func parseProcStatm(statm string) (pages int64, err error) {
+	fields := strings.Fields(statm)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("malformed statm: %q", statm)
+	}
+	return strconv.ParseInt(fields[1], 10, 64)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat := "4242 (kv bench (x)) S 1 4242 4242 34816 4242 4194304 1862 0 0 0 250 37 0 0 20 0 9 0 1042 1234567 890 18446744073709551615\n"
+	user, sys, err := parseProcStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != 2500*time.Millisecond {
+		t.Errorf("expected 2.5s user, got %s", user)
+	}
+	if sys != 370*time.Millisecond {
+		t.Errorf("expected 370ms sys, got %s", sys)
+	}
+
+	_, _, err = parseProcStat("4242 (kvbench) S 1")
+	if err == nil {
+		t.Error("expected an error for a truncated stat")
+	}
+}
+
+func TestParseProcStatm(t *testing.T) {
+	pages, err := parseProcStatm("311234 2048 1024 300 0 100000 0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2048 {
+		t.Errorf("expected 2048 pages, got %d", pages)
+	}
+
+	_, err = parseProcStatm("311234")
+	if err == nil {
+		t.Error("expected an error for a truncated statm")
+	}
+}
+
+func TestResourceSampleSub(t *testing.T) {
+	prev := ResourceSample{
+		User: time.Second, Sys: time.Second, RSS: 10, HeapAlloc: 10,
+		TotalAlloc: 100, Mallocs: 10, NumGC: 1, PauseTotal: time.Millisecond,
+	}
+	cur := ResourceSample{
+		User: 3 * time.Second, Sys: 2 * time.Second, RSS: 20, HeapAlloc: 5,
+		TotalAlloc: 300, Mallocs: 40, NumGC: 4, PauseTotal: 3 * time.Millisecond,
+	}
+
+	d := cur.Sub(prev)
+	expected := ResourceSample{
+		User: 2 * time.Second, Sys: time.Second, RSS: 20, HeapAlloc: 5,
+		TotalAlloc: 200, Mallocs: 30, NumGC: 3, PauseTotal: 2 * time.Millisecond,
+	}
+	if d != expected {
+		t.Errorf("expected %+v, got %+v", expected, d)
+	}
+
+	prev.User, prev.Sys = -1, -1
+	if d = cur.Sub(prev); d.User != -1 || d.Sys != -1 {
+		t.Errorf("expected unknown cpu time, got %s user %s sys", d.User, d.Sys)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// respConn is a connection to a server speaking the
+// Redis serialization protocol (RESP).  Each write and
+// each reply read must complete within timeout, if it is
+// not 0, so that a stalled server fails the command rather
+// than hanging it.
+type respConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+
+	mu          sync.Mutex
+	ctxDeadline time.Time // the deadline of the watched context
+	interrupted bool      // the watched context is done
+}
+
+// respError is an error reply sent by the server.
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+// dialRESP connects to addr within timeout, which then
+// limits each command sent on the connection.
+func dialRESP(addr string, timeout time.Duration) (c *respConn, err error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return
+	}
+	return newRESPConn(conn, timeout), nil
+}
+
+func newRESPConn(conn net.Conn, timeout time.Duration) *respConn {
+	return &respConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		timeout: timeout,
+	}
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
+
+// aLongTimeAgo is a deadline in the past, which interrupts
+// any read or write in progress.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// watch applies the deadline of ctx to the connection, and
+// interrupts its reads and writes once ctx is done, until
+// the returned function is called.
+func (c *respConn) watch(ctx context.Context) (release func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	c.mu.Lock()
+	c.ctxDeadline, _ = ctx.Deadline()
+	c.mu.Unlock()
+
+	stop, stopped := make(chan bool), make(chan bool)
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.interrupted = true
+			c.conn.SetDeadline(aLongTimeAgo)
+			c.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		c.mu.Lock()
+		c.ctxDeadline, c.interrupted = time.Time{}, false
+		c.conn.SetDeadline(time.Time{})
+		c.mu.Unlock()
+	}
+}
+
+// setDeadline limits the next read or write to the
+// connection's timeout, or to the deadline of the watched
+// context if that is sooner.  Once the context is done the
+// deadline is left in the past.
+func (c *respConn) setDeadline() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.interrupted {
+		return nil
+	}
+	d := c.ctxDeadline
+	if c.timeout > 0 {
+		if t := time.Now().Add(c.timeout); d.IsZero() || t.Before(d) {
+			d = t
+		}
+	}
+	return c.conn.SetDeadline(d)
+}
+
+// Send buffers a command without waiting for its reply,
+// so that several commands can be pipelined.
+func (c *respConn) Send(args ...[]byte) (err error) {
+	// the buffer is written to the server once it fills
+	if err = c.setDeadline(); err != nil {
+		return
+	}
+	if _, err = fmt.Fprintf(c.w, "*%d\r\n", len(args)); err != nil {
+		return
+	}
+	for _, arg := range args {
+		if _, err = fmt.Fprintf(c.w, "$%d\r\n", len(arg)); err != nil {
+			return
+		}
+		if _, err = c.w.Write(arg); err != nil {
+			return
+		}
+		if _, err = c.w.WriteString("\r\n"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Flush writes any buffered commands to the server.
+func (c *respConn) Flush() error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// Do sends a command and returns its reply.
+func (c *respConn) Do(args ...[]byte) (reply interface{}, err error) {
+	if err = c.Send(args...); err != nil {
+		return
+	}
+	if err = c.Flush(); err != nil {
+		return
+	}
+	return c.Receive()
+}
+
+// Receive reads one reply.  Simple strings are returned
+// as string, integers as int64, bulk strings as []byte
+// (nil for a null bulk string), arrays as []interface{}
+// and error replies as a respError value.
+func (c *respConn) Receive() (reply interface{}, err error) {
+	if err = c.setDeadline(); err != nil {
+		return
+	}
+	return readRESP(c.r)
+}
+
+func readRESP(r *bufio.Reader) (reply interface{}, err error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed RESP line: %q", line)
+	}
+	t, line := line[0], line[1:len(line)-2]
+
+	switch t {
+	case '+':
+		return string(line), nil
+	case '-':
+		return respError(line), nil
+	case ':':
+		return strconv.ParseInt(string(line), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line))
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line))
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unknown RESP type %q", t)
+}
+
+// respOK returns an error if reply is not a
+// successful reply.
+func respOK(reply interface{}) error {
+	if err, ok := reply.(respError); ok {
+		return err
+	}
+	return nil
+}
+
+var errRESPReply = errors.New("unexpected RESP reply")
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respServer is a minimal in-memory server speaking the
+// subset of the Redis protocol used by RESPCollection.
+type respServer struct {
+	sync.Mutex
+	l net.Listener
+	m map[string][]byte
+}
+
+func newRESPServer(t *testing.T) *respServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &respServer{l: l, m: make(map[string][]byte)}
+	go s.serve()
+	return s
+}
+
+func (s *respServer) Addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *respServer) Close() error {
+	return s.l.Close()
+}
+
+func (s *respServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *respServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		req, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		a, ok := req.([]interface{})
+		if !ok || len(a) == 0 {
+			fmt.Fprintf(w, "-ERR expected a command array\r\n")
+		} else {
+			args := make([][]byte, len(a))
+			for i := range a {
+				args[i], _ = a[i].([]byte)
+			}
+			s.do(w, strings.ToUpper(string(args[0])), args[1:])
+		}
+		// flush once the pipeline has been drained
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	if b == nil {
+		fmt.Fprintf(w, "$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(b), b)
+}
+
+func (s *respServer) do(w *bufio.Writer, cmd string, args [][]byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch cmd {
+	case "PING":
+		fmt.Fprintf(w, "+PONG\r\n")
+	case "MSET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			fmt.Fprintf(w, "-ERR wrong number of arguments for 'mset' command\r\n")
+			return
+		}
+		for i := 0; i < len(args); i += 2 {
+			s.m[string(args[i])] = args[i+1]
+		}
+		fmt.Fprintf(w, "+OK\r\n")
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, k := range args {
+			writeBulk(w, s.m[string(k)])
+		}
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := s.m[string(k)]; ok {
+				delete(s.m, string(k))
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "SCAN":
+		s.scan(w, args)
+	case "INFO":
+		writeBulk(w, []byte(fmt.Sprintf("# Memory\r\nused_memory:%d\r\n", len(s.m))))
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// scan pages through the sorted keys, using the index
+// of the next key as the cursor.  Only MATCH patterns
+// of the form prefix* are supported.
+func (s *respServer) scan(w *bufio.Writer, args [][]byte) {
+	cursor, _ := strconv.Atoi(string(args[0]))
+	count, prefix := 10, []byte(nil)
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT":
+			count, _ = strconv.Atoi(string(args[i+1]))
+		case "MATCH":
+			prefix = bytes.TrimSuffix(args[i+1], []byte("*"))
+		}
+	}
+
+	keys := make([]string, 0, len(s.m))
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var page []string
+	for ; cursor < len(keys) && len(page) < count; cursor++ {
+		if strings.HasPrefix(keys[cursor], string(prefix)) {
+			page = append(page, keys[cursor])
+		}
+	}
+	if cursor >= len(keys) {
+		cursor = 0
+	}
+
+	fmt.Fprintf(w, "*2\r\n")
+	writeBulk(w, []byte(strconv.Itoa(cursor)))
+	fmt.Fprintf(w, "*%d\r\n", len(page))
+	for _, k := range page {
+		writeBulk(w, []byte(k))
+	}
+}
+
+func TestCollectionRESP(t *testing.T) {
+	s := newRESPServer(t)
+	defer s.Close()
+
+	// keys belonging to someone else on a shared server
+	s.m["other"] = []byte("x")
+
+	c, err := NewRESPCollection(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCollection(t, "resp", c)
+
+	if _, ok := s.m["other"]; !ok || len(s.m) != 1 {
+		t.Errorf("expected only the unprefixed key to remain, got %d keys", len(s.m))
+	}
+
+	err = c.Close(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRESPPipeline(t *testing.T) {
+	s := newRESPServer(t)
+	defer s.Close()
+
+	conn, err := dialRESP(s.Addr(), respTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cmds := [][][]byte{
+		{[]byte("MSET"), []byte("a"), []byte("1"), []byte("b"), []byte("")},
+		{[]byte("MGET"), []byte("a"), []byte("b"), []byte("c")},
+		{[]byte("DEL"), []byte("a"), []byte("c")},
+		{[]byte("NOPE")},
+	}
+	for _, cmd := range cmds {
+		if err = conn.Send(cmd...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"OK",
+		"[[49] [] <nil>]",
+		"1",
+		"ERR unknown command 'NOPE'",
+	}
+	for i, e := range expected {
+		reply, err := conn.Receive()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if s := fmt.Sprint(reply); s != e {
+			t.Errorf("reply %d: expected %s, got %s", i, e, s)
+		}
+	}
+}
+
+func TestRESPStalledServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// accept connections but never reply
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	conn, err := dialRESP(l.Addr().String(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t0 := time.Now()
+	_, err = conn.Do([]byte("PING"))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if d := time.Since(t0); d > 5*time.Second {
+		t.Errorf("expected the command to time out after 100ms, took %v", d)
+	}
+}
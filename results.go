@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// PollRecord records what a Benchmark measured at one poll.
+type PollRecord struct {
+	Time             time.Time
+	Rows             int                    // rows visited by the scan, the mean of concurrent scans
+	Scan             time.Duration          // time taken by the scan, the mean of concurrent scans
+	Resources        ResourceSample         // resource usage since the previous poll
+	ScanWindowAllocs float64                // allocations per row scanned while the scans ran, the writers' included
+	WriteAllocs      float64                // allocations per row written, outside the scan window
+	Timeouts         int                    `json:",omitempty"` // scans stopped by the scan timeout, counted in Rows and Scan
+	Interval         *Interval              `json:",omitempty"` // work done since the previous poll
+	SetLatency       *Latency               `json:",omitempty"` // of the row sets written since the previous poll
+	Disk             *DiskSample            `json:",omitempty"` // nil if the path could not be sampled
+	Stats            map[string]interface{} `json:",omitempty"` // collection stats
+	StatsDelta       map[string]interface{} `json:",omitempty"` // change in stats since the previous poll
+}
+
+// Interval is the work done between a poll and the previous
+// one, or the start of the run.
+type Interval struct {
+	Duration    time.Duration
+	RowSets     int64 // row sets written
+	Rows        int64 // rows written
+	Bytes       int64 // key and value bytes written
+	Scans       int64 // scans completed
+	RowsScanned int64 // rows visited by the scans completed
+}
+
+// Rate returns n per second of the interval, or 0 if the
+// interval took no measurable time.
+func (iv *Interval) Rate(n int64) float64 {
+	if iv.Duration <= 0 {
+		return 0
+	}
+	return float64(n) / iv.Duration.Seconds()
+}
+
+// NsPerRow returns the scan time of the poll per row
+// visited, the cost of iterating over the collection
+// independent of its size, or 0 if no rows were visited.
+func (r PollRecord) NsPerRow() float64 {
+	if r.Rows == 0 {
+		return 0
+	}
+	return float64(r.Scan) / float64(r.Rows)
+}
+
+// RowsPerSec returns the scan throughput of the poll in
+// rows per second, or 0 if the scan took no measurable time.
+func (r PollRecord) RowsPerSec() float64 {
+	if r.Scan <= 0 {
+		return 0
+	}
+	return float64(r.Rows) / r.Scan.Seconds()
+}
+
+// Results is the machine-readable outcome of a benchmark run,
+// written by kvbench run -results and read by kvbench compare.
+type Results struct {
+	sync.Mutex `json:"-"`
+
+	Id      string
+	Path    string
+	Scan    string
+	Writers int
+	Readers int
+	Start   time.Time
+	End     time.Time
+	RowSets int64         // row sets written
+	Rows    int64         // rows written
+	Arrival time.Duration // average inter-arrival time of row sets
+	Polls   []PollRecord
+
+	Interrupted bool   `json:",omitempty"` // stopped by a signal before the data file was replayed
+	Errors      int64  `json:",omitempty"` // writes that failed
+	Error       string `json:",omitempty"` // the failed write that stopped the run
+
+	Metadata *Metadata `json:",omitempty"` // the host, build and options of the run
+	Scenario *Scenario `json:",omitempty"` // the scenario run, if any
+}
+
+// Summary describes the run in one line.
+func (r *Results) Summary() string {
+	r.Lock()
+	defer r.Unlock()
+	s := fmt.Sprintf("%s: %d row sets, %d rows written in %s", r.Id, r.RowSets, r.Rows, r.End.Sub(r.Start).Round(time.Millisecond))
+	if len(r.Polls) > 0 {
+		p := r.Polls[len(r.Polls)-1]
+		s += fmt.Sprintf(", final scan of %d rows in %s (%.1f rows/s, %.1f ns/row)", p.Rows, p.Scan, p.RowsPerSec(), p.NsPerRow())
+	}
+	if r.Errors > 0 {
+		s += fmt.Sprintf(", %d failed writes", r.Errors)
+	}
+	if r.Error != "" {
+		s += ", stopped by: " + r.Error
+	}
+	if r.Interrupted {
+		s += ", interrupted"
+	}
+	return s
+}
+
+// Final returns the last poll record, or false if the run
+// was never polled.
+func (r *Results) Final() (p PollRecord, ok bool) {
+	if len(r.Polls) == 0 {
+		return
+	}
+	return r.Polls[len(r.Polls)-1], true
+}
+
+func (r *Results) add(p PollRecord) {
+	r.Lock()
+	r.Polls = append(r.Polls, p)
+	r.Unlock()
+}
+
+// Write encodes the results as indented JSON to w.
+func (r *Results) Write(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteFile writes the results to path.
+func (r *Results) WriteFile(path string) (err error) {
+	fh, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	err = r.Write(fh)
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+// ReadResults reads results written by Results.WriteFile.
+func ReadResults(path string) (r *Results, err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	r = &Results{}
+	if err = json.NewDecoder(fh).Decode(r); err != nil {
+		return nil, fmt.Errorf("unable to read results %s: %v", path, err)
+	}
+	return
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultsReadWrite(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := &Results{Id: "bolt", Scan: "rows", Start: t0, End: t0.Add(time.Minute), RowSets: 10, Rows: 100}
+	r.add(PollRecord{
+		Time:  t0.Add(time.Second),
+		Rows:  100,
+		Scan:  4 * time.Millisecond,
+		Disk:  &DiskSample{Bytes: 2000, Written: 3000, Logical: 1000, Live: 1000},
+		Stats: map[string]interface{}{"tx": 3},
+	})
+
+	file := filepath.Join(path, "results.json")
+	if err = r.WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := ReadResults(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := r2.Final()
+	if !ok {
+		t.Fatal("expected a final poll record")
+	}
+	if r2.Id != "bolt" || !r2.End.Equal(r.End) || p.Rows != 100 || p.Disk == nil || p.Disk.WriteAmp() != 3 {
+		t.Errorf("unexpected results after round trip: %+v", r2)
+	}
+	if p.RowsPerSec() != 25000 {
+		t.Errorf("expected 25000 rows/s, got %f", p.RowsPerSec())
+	}
+	if (PollRecord{Rows: 10}).RowsPerSec() != 0 {
+		t.Errorf("expected 0 rows/s for an unmeasured scan")
+	}
+}
+
+func TestPollRecordRates(t *testing.T) {
+	for _, tc := range []struct {
+		p          PollRecord
+		perSec, ns float64
+	}{
+		{PollRecord{Rows: 10, Scan: 500 * time.Nanosecond}, 2e7, 50},
+		{PollRecord{Rows: 3, Scan: 1500 * time.Microsecond}, 2000, 500000},
+		{PollRecord{Rows: 0, Scan: 200 * time.Nanosecond}, 0, 0},
+		{PollRecord{Rows: 0, Scan: 0}, 0, 0},
+	} {
+		p := tc.p
+		if p.RowsPerSec() != tc.perSec || p.NsPerRow() != tc.ns {
+			t.Errorf("%d rows in %s: expected %v rows/s and %v ns/row, got %v and %v",
+				p.Rows, p.Scan, tc.perSec, tc.ns, p.RowsPerSec(), p.NsPerRow())
+		}
+	}
+
+	iv := &Interval{Duration: 250 * time.Microsecond, Rows: 5}
+	if iv.Rate(iv.Rows) != 20000 {
+		t.Errorf("expected 20000 rows/s, got %v", iv.Rate(iv.Rows))
+	}
+	if (&Interval{Rows: 5}).Rate(5) != 0 {
+		t.Errorf("expected 0 rows/s for an unmeasured interval")
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	t0 := time.Now()
+	group := func(name string, scan time.Duration, runs int) *ResultsGroup {
+		g := &ResultsGroup{Name: name}
+		for i := 0; i < runs; i++ {
+			r := &Results{Id: "bolt", Scan: "rows", Start: t0, End: t0.Add(time.Second), Rows: 100}
+			for j := 0; j < 4; j++ {
+				// 100 rows in scan, plus a little noise
+				r.add(PollRecord{Rows: 100, Scan: scan + time.Duration(i*4+j)*time.Microsecond})
+			}
+			g.Results = append(g.Results, r)
+		}
+		return g
+	}
+
+	buf := &bytes.Buffer{}
+	groups := []*ResultsGroup{group("old", 10*time.Millisecond, 4), group("new", 5*time.Millisecond, 4)}
+	if err := CompareResults(buf, groups, 0.05); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, s := range []string{
+		"old", "new", "delta",
+		"+99.",              // rows/s doubled
+		"p=0.029 n=4+4",     // one sample per run, not per poll
+		"~ (p=1.000 n=4+4)", // duration did not change
+		"bytes on disk",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in comparison:\n%s", s, out)
+		}
+	}
+
+	// single runs are too few for a test, so only the
+	// change is shown, even for poll measurements
+	buf.Reset()
+	a, b := group("a", 10*time.Millisecond, 1), group("b", 10*time.Millisecond, 1)
+	b.Results[0].End = b.Results[0].End.Add(time.Second)
+	if err := CompareResults(buf, []*ResultsGroup{a, b}, 0.05); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"+100.00% (too few runs, n=1+1)",
+		"+0.00% (too few runs, n=1+1)",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q without a p-value:\n%s", s, buf)
+		}
+	}
+}
+
+func TestSummarizeTrials(t *testing.T) {
+	t0 := time.Now()
+	g := &ResultsGroup{Name: "bolt"}
+	for i := 1; i <= 5; i++ {
+		r := &Results{Id: "bolt", Start: t0, End: t0.Add(time.Duration(i) * time.Second), RowSets: 10}
+		// the median of the polls of each run is 100000*i rows/s
+		for _, ms := range []int{2, 1, 3} {
+			r.add(PollRecord{Rows: 100 * i * ms, Scan: time.Duration(ms) * time.Millisecond})
+		}
+		g.Results = append(g.Results, r)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := SummarizeTrials(buf, g); err != nil {
+		t.Fatal(err)
+	}
+	// compare fields rather than column widths
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	out := strings.Join(lines, "\n")
+
+	for _, s := range []string{
+		"bolt, 5 trials",
+		"mean", "stddev", "p90",
+		"rows/s scanned 5 300000.00 158113.88 100000.00 300000.00 460000.00 500000.00",
+		"duration 5 3s 1.581s 1s 3s 4.6s 5s",
+		"row sets 5 10 0 10 10 10 10",
+		"bytes on disk 0 n/a",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in summary:\n%s", s, out)
+		}
+	}
+}
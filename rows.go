@@ -6,6 +6,15 @@ type Row struct {
 	Err   error
 }
 
+// Size returns the length of the row's key and value.
+func (r Row) Size() int64 {
+	n := int64(len(r.Key.b))
+	if r.Value != nil {
+		n += int64(len(r.Value.b))
+	}
+	return n
+}
+
 type RowKey struct {
 	b []byte
 }
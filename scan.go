@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ScanMode selects how the benchmark iterates over a
+// collection, and so how much of the measured scan time
+// is spent outside of the store.
+type ScanMode int
+
+const (
+	ScanRows   ScanMode = iota // decode every row and send it through Collection.Rows
+	ScanRaw                    // ForEach, touching nothing
+	ScanCopy                   // ForEach, copying each key and value
+	ScanDecode                 // ForEach, decoding each key and value at a per-byte cost
+)
+
+func (m ScanMode) String() string {
+	switch m {
+	case ScanRows:
+		return "rows"
+	case ScanRaw:
+		return "raw"
+	case ScanCopy:
+		return "copy"
+	case ScanDecode:
+		return "decode"
+	}
+	return fmt.Sprintf("ScanMode(%d)", int(m))
+}
+
+// ParseScanMode returns the ScanMode named by s.
+func ParseScanMode(s string) (m ScanMode, err error) {
+	switch s {
+	case "rows":
+		return ScanRows, nil
+	case "raw":
+		return ScanRaw, nil
+	case "copy":
+		return ScanCopy, nil
+	case "decode":
+		return ScanDecode, nil
+	}
+	return 0, fmt.Errorf("unknown scan mode %q: expected rows, raw, copy or decode", s)
+}
+
+// Scan describes how the benchmark iterates over a
+// collection.  Cost is the number of rounds of simulated
+// work performed per byte in ScanDecode mode.
+type Scan struct {
+	Mode ScanMode
+	Cost int
+}
+
+// Timing iterates over every row in c and returns the
+// number of rows, the length of their keys and values, and
+// the time it took.  If ctx is done first it returns the
+// rows visited so far and ctx.Err().
+func (s Scan) Timing(ctx context.Context, c Collection) (n int, size int64, t time.Duration, err error) {
+	if s.Mode == ScanRows {
+		n, size, t = c.Timing(ctx)
+		err = ctx.Err()
+		return
+	}
+
+	fn := s.rowFunc()
+	t0 := time.Now()
+	err = c.ForEach(ctx, func(k, v []byte) error {
+		n++
+		size += int64(len(k) + len(v))
+		return fn(k, v)
+	})
+	t = time.Now().Sub(t0)
+	return
+}
+
+// rowFunc returns the function applied to each row
+// visited by ForEach.
+func (s Scan) rowFunc() func(k, v []byte) error {
+	switch s.Mode {
+	case ScanCopy:
+		return func(k, v []byte) error {
+			kb := make([]byte, len(k))
+			copy(kb, k)
+			vb := make([]byte, len(v))
+			copy(vb, v)
+			return nil
+		}
+	case ScanDecode:
+		return func(k, v []byte) error {
+			rk, err := DecodeRowKey(k)
+			if err != nil {
+				return err
+			}
+			rv, err := DecodeRowValue(v)
+			if err != nil {
+				return err
+			}
+			spin(rk.b, s.Cost)
+			spin(rv.b, s.Cost)
+			return nil
+		}
+	}
+	return func(k, v []byte) error {
+		return nil
+	}
+}
+
+// spinSink keeps the compiler from discarding the
+// work done by spin.
+var spinSink byte
+
+// spin performs rounds of busy work for every byte in b.
+func spin(b []byte, rounds int) {
+	var x byte
+	for _, c := range b {
+		for i := 0; i < rounds; i++ {
+			x = x*31 + c
+		}
+	}
+	spinSink += x
+}
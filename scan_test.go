@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseScanMode(t *testing.T) {
+	for _, m := range []ScanMode{ScanRows, ScanRaw, ScanCopy, ScanDecode} {
+		parsed, err := ParseScanMode(m.String())
+		if err != nil {
+			t.Error(m, err)
+			continue
+		}
+		if parsed != m {
+			t.Errorf("expected %s, got %s", m, parsed)
+		}
+	}
+
+	if _, err := ParseScanMode("fast"); err == nil {
+		t.Error("expected an error for an unknown scan mode")
+	}
+}
+
+func TestScanTiming(t *testing.T) {
+	c, err := NewNoopCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Set(context.Background(), testRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []ScanMode{ScanRows, ScanRaw, ScanCopy, ScanDecode} {
+		n, _, _, err := Scan{Mode: m, Cost: 10}.Timing(context.Background(), c)
+		if err != nil {
+			t.Error(m, err)
+			continue
+		}
+		if n != len(testRows) {
+			t.Errorf("%s: expected %d rows, got %d", m, len(testRows), n)
+		}
+	}
+
+	// testRows have one byte keys and values
+	c, err = NewMapCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Set(context.Background(), testRows); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []ScanMode{ScanRows, ScanRaw} {
+		n, size, _, err := Scan{Mode: m}.Timing(context.Background(), c)
+		if err != nil || size != 2*int64(n) || n != len(testRows) {
+			t.Errorf("%s: expected %d rows of 2 bytes, got %d rows of %d bytes, %v", m, len(testRows), n, size, err)
+		}
+	}
+}
+
+func BenchmarkScanRaw(b *testing.B)     { benchScan(b, Scan{Mode: ScanRaw}) }
+func BenchmarkScanCopy(b *testing.B)    { benchScan(b, Scan{Mode: ScanCopy}) }
+func BenchmarkScanDecode(b *testing.B)  { benchScan(b, Scan{Mode: ScanDecode}) }
+func BenchmarkScanDecode8(b *testing.B) { benchScan(b, Scan{Mode: ScanDecode, Cost: 8}) }
+
+func benchScan(b *testing.B, s Scan) {
+	fn := s.rowFunc()
+	b.SetBytes(int64(len(testKey[0]) + len(testValue[3])))
+	for i := 0; i < b.N; i++ {
+		err := fn(testKey[0], testValue[3])
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
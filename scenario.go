@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Duration is a time.Duration that is written to and read
+// from JSON as a string such as "10s" or "175ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: expected a string such as \"10s\"", b)
+	}
+	x, err := time.ParseDuration(s)
+	if err != nil {
+		return
+	}
+	*d = Duration(x)
+	return
+}
+
+// Scenario is a declarative description of a benchmark run:
+// the data file to replay and how to generate it, how row
+// sets arrive, how the database is written and read, and
+// the backends to run it against.  Scenarios are read from
+// JSON files by kvbench run -scenario.
+type Scenario struct {
+	Name     string            `json:"name"`
+	Seed     int64             `json:"seed"`
+	Data     ScenarioData      `json:"data"`
+	Arrival  ScenarioArrival   `json:"arrival"`
+	Poll     Duration          `json:"poll"`
+	Duration Duration          `json:"duration"` // stop sending after this long, 0 to replay the whole file
+	Writers  int               `json:"writers"`
+	Readers  int               `json:"readers"`
+	MaxErrs  int               `json:"max_errors"` // failed writes to skip before failing a run
+	Scan     ScenarioScan      `json:"scan"`
+	Count    int               `json:"count"`   // trials of each backend
+	Shuffle  bool              `json:"shuffle"` // shuffle the backends in each trial
+	Backends []ScenarioBackend `json:"backends"`
+	Results  string            `json:"results,omitempty"`
+	Trace    string            `json:"trace,omitempty"`  // records the operations of each run
+	Replay   string            `json:"replay,omitempty"` // trace whose schedule each run replays
+
+	metrics *Metrics          // serves the metrics of each run, if not nil
+	stop    *interrupt        // stops the runs on a signal, if not nil
+	options map[string]string // the flags given with the scenario
+}
+
+// ScenarioData names the data file of a scenario, and
+// optionally how to generate it before the run.
+type ScenarioData struct {
+	Path     string            `json:"path"`
+	Generate *ScenarioGenerate `json:"generate,omitempty"`
+}
+
+// ScenarioGenerate holds the options of kvbench generate.
+type ScenarioGenerate struct {
+	Blocks   int `json:"blocks"`
+	BlockMin int `json:"block_min"`
+	BlockMax int `json:"block_max"`
+	KeyMin   int `json:"key_min"`
+	KeyMax   int `json:"key_max"`
+	ValueMin int `json:"value_min"`
+	ValueMax int `json:"value_max"`
+}
+
+func (g *ScenarioGenerate) UnmarshalJSON(b []byte) error {
+	// fields that are not given keep the defaults of
+	// kvbench generate
+	type plain ScenarioGenerate
+	p := plain{200, 1, 1000, 32, 32, 512, 1024}
+	if err := strictUnmarshal(b, &p); err != nil {
+		return err
+	}
+	*g = ScenarioGenerate(p)
+	return nil
+}
+
+// ScenarioArrival is the range of inter-arrival times
+// of row sets.
+type ScenarioArrival struct {
+	Min Duration `json:"min"`
+	Max Duration `json:"max"`
+}
+
+// ScenarioScan is how each poll iterates over the database.
+type ScenarioScan struct {
+	Mode    string   `json:"mode"`
+	Cost    int      `json:"cost"`
+	Timeout Duration `json:"timeout"` // stop each scan after this long, 0 for no limit
+}
+
+// ScenarioBackend is one backend to run a scenario against,
+// with its database path and backend specific options.  Name
+// tells apart several runs of the same backend id.  Without
+// a path the backend runs against a temporary database, as
+// it does in every trial when the scenario's count is more
+// than one, with the path naming the directory to create
+// the database in.
+type ScenarioBackend struct {
+	Id      string            `json:"id"`
+	Name    string            `json:"name,omitempty"`
+	Path    string            `json:"path"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// label returns the name of the backend, or its id.
+func (b ScenarioBackend) label() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return b.Id
+}
+
+// backendOptions lists the options accepted by each
+// backend in a scenario.
+var backendOptions = map[string][]string{
+	"sqlite": {"journal", "sync"},
+}
+
+// collectionOptions returns the options to open the
+// collection of b with.
+func (b ScenarioBackend) collectionOptions() (o CollectionOptions) {
+	switch b.Id {
+	case "sqlite":
+		o.SQLite.Journal = b.Options["journal"]
+		o.SQLite.Synchronous = b.Options["sync"]
+	}
+	return
+}
+
+// newScenario returns a Scenario holding the defaults
+// of kvbench run.
+func newScenario() *Scenario {
+	return &Scenario{
+		Arrival: ScenarioArrival{Duration(500 * time.Millisecond), Duration(time.Second)},
+		Poll:    Duration(10 * time.Second),
+		Writers: 1,
+		Readers: 1,
+		Scan:    ScenarioScan{Mode: "rows"},
+		Count:   1,
+	}
+}
+
+// ParseScenario parses a JSON scenario, rejecting unknown
+// fields.  Fields that are not given take the defaults of
+// kvbench run.
+func ParseScenario(b []byte) (s *Scenario, err error) {
+	s = newScenario()
+	if err = strictUnmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadScenario reads and validates the scenario at path.
+// Relative data, database, results and trace paths are resolved
+// against the directory holding the scenario.
+func LoadScenario(path string) (s *Scenario, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	s, err = ParseScenario(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scenario %s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	s.Data.Path = resolvePath(dir, s.Data.Path)
+	s.Results = resolvePath(dir, s.Results)
+	s.Trace = resolvePath(dir, s.Trace)
+	s.Replay = resolvePath(dir, s.Replay)
+	for i := range s.Backends {
+		if s.Backends[i].Id != "remote" && s.Backends[i].Id != "resp" {
+			s.Backends[i].Path = resolvePath(dir, s.Backends[i].Path)
+		}
+	}
+
+	if err = s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %v", path, err)
+	}
+	return
+}
+
+func strictUnmarshal(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Validate checks the scenario the way kvbench generate and
+// kvbench run check their options.
+func (s *Scenario) Validate() (err error) {
+	if gen := s.generateConfig(); gen != nil {
+		if err = gen.validate(); err != nil {
+			return
+		}
+	}
+	if len(s.Backends) == 0 {
+		return fmt.Errorf("no backends")
+	}
+	if s.Writers < 1 || s.Readers < 1 {
+		return fmt.Errorf("invalid writers %d and readers %d: at least one of each is required", s.Writers, s.Readers)
+	}
+	if s.MaxErrs < 0 {
+		return fmt.Errorf("invalid max_errors %d", s.MaxErrs)
+	}
+	if s.Count < 1 {
+		return fmt.Errorf("invalid count %d", s.Count)
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("invalid duration %s", time.Duration(s.Duration))
+	}
+
+	labels := make(map[string]bool, len(s.Backends))
+	for _, b := range s.Backends {
+		if labels[b.label()] {
+			return fmt.Errorf("%s: backend listed twice, give each a distinct name", b.label())
+		}
+		labels[b.label()] = true
+
+		if err = s.runConfig(b).validate(); err != nil {
+			return fmt.Errorf("%s: %v", b.label(), err)
+		}
+
+		keys := make([]string, 0, len(b.Options))
+		for k := range b.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !contains(backendOptions[b.Id], k) {
+				return fmt.Errorf("%s: unknown option %q", b.label(), k)
+			}
+		}
+	}
+	return nil
+}
+
+// generateConfig returns the options to generate the data
+// file with, or nil if the scenario uses an existing file.
+func (s *Scenario) generateConfig() *generateConfig {
+	g := s.Data.Generate
+	if g == nil {
+		return nil
+	}
+	return &generateConfig{
+		seed:   s.Seed,
+		blocks: g.Blocks,
+		b0:     g.BlockMin,
+		b1:     g.BlockMax,
+		k0:     g.KeyMin,
+		k1:     g.KeyMax,
+		v0:     g.ValueMin,
+		v1:     g.ValueMax,
+		output: s.Data.Path,
+	}
+}
+
+// runConfig returns the options to run backend b with.
+func (s *Scenario) runConfig(b ScenarioBackend) *runConfig {
+	results := s.Results
+	if results != "" && len(s.Backends) > 1 {
+		results = resultsPath(results, b.label())
+	}
+	trace := s.Trace
+	if trace != "" && len(s.Backends) > 1 {
+		trace = resultsPath(trace, b.label())
+	}
+
+	return &runConfig{
+		seed:         s.Seed,
+		d0:           time.Duration(s.Arrival.Min),
+		d1:           time.Duration(s.Arrival.Max),
+		p:            time.Duration(s.Poll),
+		duration:     time.Duration(s.Duration),
+		writers:      s.Writers,
+		readers:      s.Readers,
+		maxErrs:      s.MaxErrs,
+		input:        s.Data.Path,
+		id:           b.Id,
+		path:         b.Path,
+		fresh:        b.Path == "" && !contains(serverIds, b.Id),
+		results:      results,
+		trace:        trace,
+		replay:       s.Replay,
+		scanMode:     s.Scan.Mode,
+		scanCost:     s.Scan.Cost,
+		scanTimeout:  time.Duration(s.Scan.Timeout),
+		faultTimeout: 30 * time.Second,
+		collection:   b.collectionOptions(),
+		scenario:     s,
+		options:      s.options,
+		metrics:      s.metrics,
+		stop:         s.stop,
+	}
+}
+
+// Run generates the scenario's data file if it has generate
+// options, then runs each backend in turn.
+func (s *Scenario) Run() (err error) {
+	if gen := s.generateConfig(); gen != nil {
+		if err = gen.generate(NewRandom(s.Seed)); err != nil {
+			return
+		}
+	}
+
+	configs := make([]*runConfig, len(s.Backends))
+	labels := make([]string, len(s.Backends))
+	for i, b := range s.Backends {
+		configs[i], labels[i] = s.runConfig(b), b.label()
+		if i == 0 {
+			configs[0].describeData()
+		}
+		configs[i].data = configs[0].data
+	}
+	log.Printf("running scenario %s\n", s.Name)
+	return runTrials(configs, labels, s.Count, s.Shuffle)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	s, err := ParseScenario([]byte(`{
+		"name": "test",
+		"data": {"path": "x.dat", "generate": {"blocks": 3, "value_max": 600}},
+		"arrival": {"min": "1ms", "max": "5ms"},
+		"backends": [{"id": "bolt", "path": "x.db"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Duration(s.Arrival.Max) != 5*time.Millisecond {
+		t.Errorf("expected a maximum arrival of 5ms, got %s", time.Duration(s.Arrival.Max))
+	}
+	if time.Duration(s.Poll) != 10*time.Second || s.Writers != 1 || s.Readers != 1 || s.Scan.Mode != "rows" {
+		t.Errorf("expected the defaults of kvbench run, got %+v", s)
+	}
+
+	gen := s.generateConfig()
+	if gen.blocks != 3 || gen.v1 != 600 || gen.v0 != 512 || gen.b1 != 1000 {
+		t.Errorf("expected generate options with defaults, got %+v", gen)
+	}
+	if err = s.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, bad := range []string{
+		`{"nmae": "typo"}`,
+		`{"poll": 10}`,
+		`{"poll": "ten seconds"}`,
+		`{"data": {"generate": {"bloks": 1}}}`,
+	} {
+		if _, err = ParseScenario([]byte(bad)); err == nil {
+			t.Errorf("expected an error parsing %s", bad)
+		}
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	valid := func() *Scenario {
+		s := newScenario()
+		s.Data.Path = "x.dat"
+		s.Backends = []ScenarioBackend{{Id: "sqlite", Path: "x.db", Options: map[string]string{"journal": "delete"}}}
+		return s
+	}
+	if err := valid().Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, fn := range []func(s *Scenario){
+		func(s *Scenario) { s.Backends = nil },
+		func(s *Scenario) { s.Backends[0].Id = "nosuchdb" },
+		func(s *Scenario) { s.Backends[0].Options["cache"] = "1" },
+		func(s *Scenario) { s.Backends = append(s.Backends, s.Backends[0]) },
+		func(s *Scenario) { s.Data.Path = "" },
+		func(s *Scenario) { s.Readers = 0 },
+		func(s *Scenario) { s.Duration = -1 },
+		func(s *Scenario) { s.Data.Generate = &ScenarioGenerate{KeyMin: 0} },
+	} {
+		s := valid()
+		fn(s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", s)
+		}
+	}
+
+	s := valid()
+	s.Backends = append(s.Backends, ScenarioBackend{Id: "sqlite", Name: "sqlite-2", Path: "y.db"})
+	if err := s.Validate(); err != nil {
+		t.Errorf("unexpected error for distinctly named backends: %v", err)
+	}
+}
+
+func TestLoadScenarioExamples(t *testing.T) {
+	files, err := filepath.Glob("scenarios/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected example scenarios")
+	}
+	for _, file := range files {
+		s, err := LoadScenario(file)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if !strings.HasPrefix(s.Data.Path, "scenarios") {
+			t.Errorf("%s: expected the data path to be relative to the scenario, got %s", file, s.Data.Path)
+		}
+	}
+}
+
+func TestScenarioRun(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "scenario.json")
+	err = ioutil.WriteFile(file, []byte(`{
+		"name": "run",
+		"seed": 3,
+		"data": {"path": "x.dat", "generate": {"blocks": 10, "block_max": 20, "value_min": 8, "value_max": 16}},
+		"arrival": {"min": "0s", "max": "0s"},
+		"poll": "20ms",
+		"writers": 2,
+		"readers": 3,
+		"backends": [{"id": "map"}, {"id": "btree", "name": "tree"}],
+		"results": "out.json"
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadScenario(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"out.map.json", "out.tree.json"} {
+		r, err := ReadResults(filepath.Join(path, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Scenario == nil || r.Scenario.Name != "run" || len(r.Scenario.Backends) != 2 {
+			t.Errorf("%s: expected the scenario in the results, got %+v", name, r.Scenario)
+		}
+		if r.RowSets != 10 || r.Writers != 2 || r.Readers != 3 {
+			t.Errorf("%s: expected 10 row sets from 2 writers and 3 readers, got %+v", name, r)
+		}
+		p, ok := r.Final()
+		if !ok || int64(p.Rows) != r.Rows {
+			t.Errorf("%s: expected the final scans to visit every row, got %+v", name, p)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Median returns the median of xs, which must not be empty.
+func Median(xs []float64) float64 {
+	s := sorted(xs)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// Mean returns the mean of xs, which must not be empty.
+func Mean(xs []float64) (m float64) {
+	for _, x := range xs {
+		m += x
+	}
+	return m / float64(len(xs))
+}
+
+// StdDev returns the sample standard deviation of xs, or 0
+// when xs has fewer than two values.
+func StdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := Mean(xs)
+	var ss float64
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// Percentile returns the q-th percentile of xs, which must
+// not be empty, interpolating linearly between the closest
+// ranks.  Percentile(xs, 0) and Percentile(xs, 100) are the
+// minimum and maximum of xs.
+func Percentile(xs []float64, q float64) float64 {
+	s := sorted(xs)
+	r := q / 100 * float64(len(s)-1)
+	i := int(math.Floor(r))
+	if i >= len(s)-1 {
+		return s[len(s)-1]
+	}
+	return s[i] + (r-float64(i))*(s[i+1]-s[i])
+}
+
+// MedianCI returns a distribution-free confidence interval
+// for the median of xs at confidence level conf, using the
+// order statistics of xs.  ok is false when xs has too few
+// values for an interval at that level (fewer than six for
+// a 95% interval).
+func MedianCI(xs []float64, conf float64) (lo, hi float64, ok bool) {
+	s := sorted(xs)
+	n := len(s)
+
+	// the interval between the k-th smallest and k-th largest
+	// values covers the median with probability P(k <= B < n-k+1)
+	// for B ~ Binomial(n, 1/2); find the narrowest that is at
+	// least conf
+	k := 0
+	for i := 1; 2*i <= n; i++ {
+		if 1-2*binomialCDF(n, i-1) < conf {
+			break
+		}
+		k = i
+	}
+	if k == 0 {
+		return 0, 0, false
+	}
+	return s[k-1], s[n-k], true
+}
+
+// binomialCDF returns P(B <= k) for B ~ Binomial(n, 1/2).
+func binomialCDF(n, k int) (p float64) {
+	c := math.Pow(0.5, float64(n)) // P(B = 0)
+	for i := 0; i <= k; i++ {
+		p += c
+		c = c * float64(n-i) / float64(i+1)
+	}
+	return
+}
+
+// MannWhitneyU returns the two-sided p-value of the
+// Mann-Whitney U test of whether x and y are drawn from the
+// same distribution.  The exact distribution of U is used
+// for small samples without ties, and otherwise the normal
+// approximation with a correction for ties.
+func MannWhitneyU(x, y []float64) (p float64) {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type obs struct {
+		v float64
+		x bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// sum the ranks of x, giving tied values the mean of
+	// their ranks, and the tie correction term
+	var r1, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].x {
+				r1 += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	u := r1 - float64(n1*(n1+1))/2
+
+	if ties == 0 && n1+n2 <= 50 {
+		lower := mannWhitneyCDF(n1, n2, int(u))
+		upper := 1 - mannWhitneyCDF(n1, n2, int(u)-1)
+		return math.Min(1, 2*math.Min(lower, upper))
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		return 1
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// mannWhitneyCDF returns P(U <= u) for the U statistic of
+// samples of n1 and n2 values without ties.
+func mannWhitneyCDF(n1, n2, u int) (p float64) {
+	if u < 0 {
+		return 0
+	}
+	max := n1 * n2
+	if u >= max {
+		return 1
+	}
+
+	// pr[i][j][k] is P(U = k) for samples of i and j values:
+	// the largest value is from the first sample, adding j to
+	// U, with probability i/(i+j)
+	pr := make([][][]float64, n1+1)
+	for i := range pr {
+		pr[i] = make([][]float64, n2+1)
+		for j := range pr[i] {
+			pr[i][j] = make([]float64, i*j+1)
+			if i == 0 || j == 0 {
+				pr[i][j][0] = 1
+				continue
+			}
+			a, b := float64(i)/float64(i+j), float64(j)/float64(i+j)
+			for k := range pr[i][j] {
+				if k >= j && k-j < len(pr[i-1][j]) {
+					pr[i][j][k] += a * pr[i-1][j][k-j]
+				}
+				if k < len(pr[i][j-1]) {
+					pr[i][j][k] += b * pr[i][j-1][k]
+				}
+			}
+		}
+	}
+
+	for k := 0; k <= u; k++ {
+		p += pr[n1][n2][k]
+	}
+	return
+}
+
+// mannWhitneyMinP returns the smallest two-sided p-value the
+// Mann-Whitney U test can produce for samples of n1 and n2
+// values: 2 / C(n1+n2, n1).
+func mannWhitneyMinP(n1, n2 int) float64 {
+	p := 2.0
+	for i := 1; i <= n1; i++ {
+		p = p * float64(i) / float64(n2+i)
+	}
+	return math.Min(1, p)
+}
+
+func sorted(xs []float64) []float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	return s
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	if m := Median([]float64{3, 1, 2}); m != 2 {
+		t.Errorf("expected 2, got %f", m)
+	}
+	if m := Median([]float64{4, 1, 3, 2}); m != 2.5 {
+		t.Errorf("expected 2.5, got %f", m)
+	}
+}
+
+func TestMeanStdDevPercentile(t *testing.T) {
+	xs := []float64{4, 2, 5, 1, 3}
+	if m := Mean(xs); m != 3 {
+		t.Errorf("expected a mean of 3, got %f", m)
+	}
+	if sd := StdDev(xs); math.Abs(sd-math.Sqrt(2.5)) > 1e-12 {
+		t.Errorf("expected a standard deviation of %f, got %f", math.Sqrt(2.5), sd)
+	}
+	if sd := StdDev([]float64{7}); sd != 0 {
+		t.Errorf("expected no deviation for one value, got %f", sd)
+	}
+	for _, c := range []struct{ q, p float64 }{{0, 1}, {50, 3}, {90, 4.6}, {100, 5}} {
+		if p := Percentile(xs, c.q); math.Abs(p-c.p) > 1e-12 {
+			t.Errorf("expected percentile %g to be %g, got %g", c.q, c.p, p)
+		}
+	}
+}
+
+func TestMedianCI(t *testing.T) {
+	if _, _, ok := MedianCI([]float64{1, 2, 3, 4, 5}, 0.95); ok {
+		t.Errorf("expected no 95%% interval for 5 values")
+	}
+
+	xs := []float64{6, 1, 5, 2, 4, 3}
+	lo, hi, ok := MedianCI(xs, 0.95)
+	if !ok || lo != 1 || hi != 6 {
+		t.Errorf("expected [1, 6] for 6 values, got [%f, %f] %v", lo, hi, ok)
+	}
+
+	// for 20 values the 95% interval is between the 6th
+	// smallest and 6th largest
+	xs = make([]float64, 20)
+	for i := range xs {
+		xs[i] = float64(i + 1)
+	}
+	lo, hi, ok = MedianCI(xs, 0.95)
+	if !ok || lo != 6 || hi != 15 {
+		t.Errorf("expected [6, 15] for 20 values, got [%f, %f] %v", lo, hi, ok)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// completely separated samples of 5 and 5 values: the
+	// exact two-sided p-value is 2/C(10, 5)
+	x := []float64{1, 2, 3, 4, 5}
+	y := []float64{6, 7, 8, 9, 10}
+	want := 2.0 / 252
+	if p := MannWhitneyU(x, y); math.Abs(p-want) > 1e-12 {
+		t.Errorf("expected p=%g, got %g", want, p)
+	}
+	if p := MannWhitneyU(y, x); math.Abs(p-want) > 1e-12 {
+		t.Errorf("expected a symmetric p=%g, got %g", want, p)
+	}
+	if p := mannWhitneyMinP(5, 5); math.Abs(p-want) > 1e-12 {
+		t.Errorf("expected a minimum p=%g, got %g", want, p)
+	}
+
+	// interleaved samples do not differ
+	if p := MannWhitneyU([]float64{1, 3, 5, 7}, []float64{2, 4, 6, 8}); p < 0.5 {
+		t.Errorf("expected a large p-value for interleaved samples, got %g", p)
+	}
+
+	// identical values
+	if p := MannWhitneyU([]float64{1, 1, 1}, []float64{1, 1, 1}); p != 1 {
+		t.Errorf("expected p=1 for identical samples, got %g", p)
+	}
+
+	// ties use the normal approximation: x is clearly
+	// smaller than y
+	x = []float64{1, 1, 2, 2, 3, 3, 4, 4}
+	y = []float64{5, 5, 6, 6, 7, 7, 8, 8}
+	if p := MannWhitneyU(x, y); p > 0.01 {
+		t.Errorf("expected a small p-value with ties, got %g", p)
+	}
+
+	// the exact distribution sums to one
+	if p := mannWhitneyCDF(4, 6, 24); p != 1 {
+		t.Errorf("expected P(U <= 24) = 1, got %g", p)
+	}
+	if p := mannWhitneyCDF(4, 6, 0); math.Abs(p-1.0/210) > 1e-12 {
+		t.Errorf("expected P(U = 0) = 1/210, got %g", p)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsCollection is implemented by collections that can
+// report statistics about the internals of their store.
+// Values are counters or gauges of type int, int64, uint64,
+// float64 or time.Duration, or any other value that is
+// reported as-is.
+type StatsCollection interface {
+	Stats() map[string]interface{}
+}
+
+// StatsDelta returns the change in each numeric value from
+// prev to cur.  Values that are not numeric, or that are
+// missing from prev, are omitted.
+func StatsDelta(cur, prev map[string]interface{}) map[string]interface{} {
+	d := make(map[string]interface{}, len(cur))
+	for k, v := range cur {
+		p, ok := prev[k]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case int:
+			if p, ok := p.(int); ok {
+				d[k] = v - p
+			}
+		case int64:
+			if p, ok := p.(int64); ok {
+				d[k] = v - p
+			}
+		case uint64:
+			if p, ok := p.(uint64); ok {
+				d[k] = int64(v - p)
+			}
+		case float64:
+			if p, ok := p.(float64); ok {
+				d[k] = v - p
+			}
+		case time.Duration:
+			if p, ok := p.(time.Duration); ok {
+				d[k] = v - p
+			}
+		}
+	}
+	return d
+}
+
+// formatStats formats cur as space separated key=value
+// pairs in key order, followed by the delta in parens
+// for numeric values that have changed.
+func formatStats(cur, delta map[string]interface{}) string {
+	keys := make([]string, 0, len(cur))
+	for k := range cur {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		s := fmt.Sprintf("%s=%v", k, cur[k])
+		switch d := delta[k].(type) {
+		case int:
+			if d != 0 {
+				s += fmt.Sprintf("(%+d)", d)
+			}
+		case int64:
+			if d != 0 {
+				s += fmt.Sprintf("(%+d)", d)
+			}
+		case float64:
+			if d != 0 {
+				s += fmt.Sprintf("(%+.6g)", d)
+			}
+		case time.Duration:
+			if d > 0 {
+				s += fmt.Sprintf("(+%s)", d)
+			} else if d < 0 {
+				s += fmt.Sprintf("(%s)", d)
+			}
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseLevelDBStats parses the compaction table returned
+// by goleveldb's leveldb.stats property into per-level
+// values keyed by level<n>.<column>.
+func parseLevelDBStats(stats string, m map[string]interface{}) {
+	columns := []string{"tables", "size_mb", "compaction_sec", "read_mb", "write_mb"}
+
+	s := bufio.NewScanner(strings.NewReader(stats))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "|")
+		if len(fields) != len(columns)+1 {
+			continue
+		}
+
+		level, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			continue // header or separator
+		}
+
+		for i, col := range columns {
+			v := strings.TrimSpace(fields[i+1])
+			k := fmt.Sprintf("level%d.%s", level, col)
+			if col == "tables" {
+				if n, err := strconv.Atoi(v); err == nil {
+					m[k] = n
+				}
+			} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+				m[k] = f
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsDelta(t *testing.T) {
+	prev := map[string]interface{}{
+		"int":      1,
+		"int64":    int64(10),
+		"uint64":   uint64(7),
+		"float64":  1.5,
+		"duration": time.Second,
+		"bool":     false,
+		"mismatch": 1,
+	}
+	cur := map[string]interface{}{
+		"int":      3,
+		"int64":    int64(4),
+		"uint64":   uint64(9),
+		"float64":  2.0,
+		"duration": 3 * time.Second,
+		"bool":     true,
+		"mismatch": int64(2),
+		"new":      5,
+	}
+
+	d := StatsDelta(cur, prev)
+	expected := map[string]interface{}{
+		"int":      2,
+		"int64":    int64(-6),
+		"uint64":   int64(2),
+		"float64":  0.5,
+		"duration": 2 * time.Second,
+	}
+	if len(d) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, d)
+	}
+	for k, v := range expected {
+		if d[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, d[k])
+		}
+	}
+
+	s := formatStats(cur, d)
+	fs := "bool=true duration=3s(+2s) float64=2(+0.5) int=3(+2) int64=4(-6) mismatch=2 new=5 uint64=9(+2)"
+	if s != fs {
+		t.Errorf("expected %q, got %q", fs, s)
+	}
+}
+
+func TestParseLevelDBStats(t *testing.T) {
+	stats := "Compactions\n" +
+		" Level |   Tables   |    Size(MB)   |    Time(sec)  |    Read(MB)   |   Write(MB)\n" +
+		"-------+------------+---------------+---------------+---------------+---------------\n" +
+		"   0   |          3 |      10.27646 |       0.07409 |       0.00000 |      23.35579\n" +
+		"   1   |          7 |      13.08552 |       0.05188 |      13.07933 |      13.08552\n"
+
+	m := make(map[string]interface{})
+	parseLevelDBStats(stats, m)
+
+	expected := map[string]interface{}{
+		"level0.tables":         3,
+		"level0.size_mb":        10.27646,
+		"level0.compaction_sec": 0.07409,
+		"level0.read_mb":        0.0,
+		"level0.write_mb":       23.35579,
+		"level1.tables":         7,
+		"level1.size_mb":        13.08552,
+		"level1.compaction_sec": 0.05188,
+		"level1.read_mb":        13.07933,
+		"level1.write_mb":       13.08552,
+	}
+	if len(m) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, m[k])
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TraceOp is one operation of a run, as recorded in a
+// trace written with -trace.  Op is one of
+//
+//	send - a row set sent to the writers, after Delay
+//	set  - a row set written by writer Worker
+//	poll - a poll started on the poll interval
+//	end  - the final poll, once every row set was written
+//	scan - a scan by reader Worker during poll Seq
+type TraceOp struct {
+	Op     string        `json:"op"`
+	Seq    int64         `json:"seq"`                // the row set or poll
+	At     time.Duration `json:"at"`                 // since the start of the run
+	Delay  time.Duration `json:"delay,omitempty"`    // the inter-arrival time drawn before a send
+	Rows   int           `json:"rows,omitempty"`     // rows sent, written or scanned
+	Worker int           `json:"worker,omitempty"`   // the writer or reader
+	Dur    time.Duration `json:"duration,omitempty"` // time to write or scan
+	Err    string        `json:"error,omitempty"`
+}
+
+// Trace records the operations of a run to a file, one
+// JSON TraceOp per line.  A nil Trace records nothing.
+type Trace struct {
+	mu    sync.Mutex
+	fh    *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Time
+	err   error
+}
+
+// CreateTrace creates the trace file at path.
+func CreateTrace(path string) (t *Trace, err error) {
+	fh, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace %s: %v", path, err)
+	}
+	w := bufio.NewWriter(fh)
+	return &Trace{fh: fh, w: w, enc: json.NewEncoder(w), start: time.Now()}, nil
+}
+
+// begin sets the start of the run that operations are
+// timed from.
+func (t *Trace) begin(start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.start = start
+	t.mu.Unlock()
+}
+
+// Record appends op to the trace, timed now.  The first
+// error is kept and returned by Close.
+func (t *Trace) Record(op TraceOp) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op.At = time.Since(t.start)
+	if err := t.enc.Encode(op); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Close flushes and closes the trace file.
+func (t *Trace) Close() (err error) {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = t.err
+	if ferr := t.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := t.fh.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+// ReadTrace reads the operations recorded in the trace
+// file at path.
+func ReadTrace(path string) (ops []TraceOp, err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(fh))
+	for {
+		var op TraceOp
+		if err = dec.Decode(&op); err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read trace %s: %v", path, err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+// Schedule is the timing of a traced run that -replay
+// repeats: the inter-arrival time drawn before each row
+// set after the first, and when each poll started.
+type Schedule struct {
+	Sends  int
+	Delays []time.Duration
+	Polls  []time.Duration
+}
+
+// ReadSchedule reads the schedule of the run traced in
+// the trace file at path.
+func ReadSchedule(path string) (s *Schedule, err error) {
+	ops, err := ReadTrace(path)
+	if err != nil {
+		return
+	}
+
+	s = &Schedule{Polls: []time.Duration{}}
+	for _, op := range ops {
+		switch op.Op {
+		case "send":
+			if s.Sends > 0 {
+				s.Delays = append(s.Delays, op.Delay)
+			}
+			s.Sends++
+		case "poll":
+			s.Polls = append(s.Polls, op.At)
+		}
+	}
+	if s.Sends == 0 {
+		return nil, fmt.Errorf("trace %s records no row sets", path)
+	}
+	return
+}
+
+// arrivals returns the traced inter-arrival times in turn,
+// and false once they are exhausted, so that a replay sends
+// as many row sets as the traced run did.
+func (s *Schedule) arrivals() func() (time.Duration, bool) {
+	i := 0
+	return func() (time.Duration, bool) {
+		if i == len(s.Delays) {
+			return 0, false
+		}
+		i++
+		return s.Delays[i-1], true
+	}
+}
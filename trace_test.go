@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTraceSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run.trace")
+
+	tr, err := CreateTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.begin(time.Now())
+	tr.Record(TraceOp{Op: "send", Seq: 1, Rows: 3})
+	tr.Record(TraceOp{Op: "set", Seq: 1, Rows: 3, Worker: 1, Dur: time.Millisecond})
+	tr.Record(TraceOp{Op: "send", Seq: 2, Delay: 5 * time.Millisecond, Rows: 2})
+	tr.Record(TraceOp{Op: "poll", Seq: 1})
+	tr.Record(TraceOp{Op: "scan", Seq: 1, Rows: 5, Err: "context deadline exceeded"})
+	tr.Record(TraceOp{Op: "send", Seq: 3, Delay: 7 * time.Millisecond, Rows: 1})
+	tr.Record(TraceOp{Op: "end", Seq: 2})
+	if err = tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := ReadTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 7 || ops[1].Worker != 1 || ops[1].Dur != time.Millisecond || ops[4].Err == "" {
+		t.Fatalf("unexpected trace %+v", ops)
+	}
+	for i := 1; i < len(ops); i++ {
+		if ops[i].At < ops[i-1].At {
+			t.Errorf("expected op %d to be timed after op %d, got %s and %s", i, i-1, ops[i].At, ops[i-1].At)
+		}
+	}
+
+	s, err := ReadSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sends != 3 || len(s.Polls) != 1 || s.Polls[0] != ops[3].At {
+		t.Errorf("expected 3 sends and a poll at %s, got %+v", ops[3].At, s)
+	}
+	next := s.arrivals()
+	for _, want := range []time.Duration{5 * time.Millisecond, 7 * time.Millisecond} {
+		if d, ok := next(); !ok || d != want {
+			t.Errorf("expected a delay of %s, got %s, %v", want, d, ok)
+		}
+	}
+	if _, ok := next(); ok {
+		t.Errorf("expected the delays to be exhausted")
+	}
+
+	// a nil trace records nothing
+	var nt *Trace
+	nt.Record(TraceOp{Op: "send"})
+	if err = nt.Close(); err != nil {
+		t.Error(err)
+	}
+}